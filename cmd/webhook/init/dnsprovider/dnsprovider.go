@@ -47,5 +47,8 @@ func Init(config configuration.Config) (provider.Provider, error) {
 	if err := env.Parse(&technitiumConfig); err != nil {
 		return nil, fmt.Errorf("reading technitiumConfig failed: %v", err)
 	}
+	if err := technitiumConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid technitiumConfig: %v", err)
+	}
 	return technitium.NewProvider(domainFilter, &technitiumConfig), nil
 }
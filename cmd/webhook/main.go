@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"io"
 
 	"github.com/chrisatcho/external-dns-technitiumdns-webhook/cmd/webhook/init/configuration"
 	"github.com/chrisatcho/external-dns-technitiumdns-webhook/cmd/webhook/init/dnsprovider"
@@ -32,4 +33,9 @@ func main() {
 	}
 	srv := server.Init(config, webhook.New(provider))
 	server.ShutdownGracefully(srv)
+	if closer, ok := provider.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Errorf("Failed to close DNS provider: %v", err)
+		}
+	}
 }
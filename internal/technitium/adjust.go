@@ -0,0 +1,151 @@
+package technitium
+
+import (
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// AdjustEndpoints normalises the desired endpoints the way Technitium stores
+// them, so they compare equal to the records read back and plans converge.
+// Names and host targets lose their trailing dot and names are lowercased,
+// addresses and CAA values get their canonical form and TTLs follow the TTL
+// policy. Properties only known to Technitium, such as the record comments,
+// are copied from the last Records call so they do not show as a diff.
+func (p *Provider) AdjustEndpoints(endpoints []*endpoint.Endpoint) ([]*endpoint.Endpoint, error) {
+	for _, e := range endpoints {
+		e.DNSName = strings.ToLower(strings.TrimSuffix(e.DNSName, "."))
+		p.adjustProperties(e)
+		e.RecordTTL = endpoint.TTL(p.ttl.apply(e.DNSName, int(e.RecordTTL)))
+		for i, target := range e.Targets {
+			e.Targets[i] = normaliseTarget(e.RecordType, target)
+		}
+	}
+	return endpoints, nil
+}
+
+// normaliseTarget returns target as Technitium reports it. Targets that do
+// not parse are returned unchanged and rejected when applied.
+func normaliseTarget(recordType, target string) string {
+	switch recordType {
+	case "A", "AAAA":
+		if ip := net.ParseIP(target); ip != nil {
+			return ip.String()
+		}
+	case "CNAME", "NS":
+		return strings.TrimSuffix(target, ".")
+	case "MX":
+		if fields := strings.Fields(target); len(fields) == 2 {
+			return canonicalNumber(fields[0]) + " " + strings.TrimSuffix(fields[1], ".")
+		}
+	case "SRV":
+		if fields := strings.Fields(target); len(fields) == 4 {
+			for i := range fields[:3] {
+				fields[i] = canonicalNumber(fields[i])
+			}
+			fields[3] = strings.TrimSuffix(fields[3], ".")
+			return strings.Join(fields, " ")
+		}
+	case "CAA":
+		if flags, tag, value, err := parseCAA(target); err == nil {
+			return formatCAA(flags, tag, value)
+		}
+	}
+	return target
+}
+
+// canonicalNumber strips the leading zeros of the numeric fields of MX and
+// SRV targets, which Technitium stores as numbers.
+func canonicalNumber(field string) string {
+	if n, err := strconv.Atoi(field); err == nil {
+		return strconv.Itoa(n)
+	}
+	return field
+}
+
+// setReported remembers the properties of endpoints and the zones they were
+// listed from for adjustProperties.
+func (p *Provider) setReported(endpoints []*endpoint.Endpoint, zones zoneIndex) {
+	names := reportedProperties
+	if p.preservePTR {
+		// the PTR state of existing records is kept as found
+		names = append(slices.Clone(names), providerSpecificPTR)
+	}
+
+	reported := make(map[string][]endpoint.ProviderSpecificProperty, len(endpoints))
+	for _, e := range endpoints {
+		key := endpointKey(e)
+		reported[key] = []endpoint.ProviderSpecificProperty{}
+		for _, name := range names {
+			if value, ok := e.GetProviderSpecificProperty(name); ok {
+				reported[key] = append(reported[key], endpoint.ProviderSpecificProperty{Name: name, Value: value})
+			}
+		}
+	}
+
+	p.reportedMu.Lock()
+	defer p.reportedMu.Unlock()
+	p.reported = reported
+	p.reportedZones = zones
+}
+
+// adjustProperties brings the properties of e in the form Records reports
+// them. Reported properties e does not set are copied from the current
+// endpoint, as is its comment when only the marker line differs. Properties
+// set to their default are dropped, as Records omits them, and so is the
+// create time only create-ptr-zone property of existing endpoints.
+func (p *Provider) adjustProperties(e *endpoint.Endpoint) {
+	p.reportedMu.Lock()
+	defer p.reportedMu.Unlock()
+
+	current, exists := p.reported[endpointKey(e)]
+	for _, property := range current {
+		// disabled records are enabled again by leaving the state to the
+		// endpoint
+		if property.Name == providerSpecificDisabled && p.disabledRecords == disabledEnable {
+			continue
+		}
+		value, ok := e.GetProviderSpecificProperty(property.Name)
+		if !ok || (property.Name == providerSpecificComments && userComment(value) == userComment(property.Value)) {
+			e.SetProviderSpecificProperty(property.Name, property.Value)
+		}
+	}
+	if exists {
+		e.DeleteProviderSpecificProperty(providerSpecificCreatePTRZone)
+	}
+
+	if value, ok := e.GetProviderSpecificProperty(providerSpecificPTR); ok {
+		if enabled, err := strconv.ParseBool(value); err == nil {
+			if (e.RecordType != "A" && e.RecordType != "AAAA") || enabled == p.createPTR {
+				e.DeleteProviderSpecificProperty(providerSpecificPTR)
+			} else {
+				e.SetProviderSpecificProperty(providerSpecificPTR, strconv.FormatBool(enabled))
+			}
+		}
+	}
+	if value, ok := e.GetProviderSpecificProperty(providerSpecificDisabled); ok {
+		if disabled, err := strconv.ParseBool(value); err == nil {
+			if disabled {
+				e.SetProviderSpecificProperty(providerSpecificDisabled, "true")
+			} else {
+				e.DeleteProviderSpecificProperty(providerSpecificDisabled)
+			}
+		}
+	}
+	if value, ok := e.GetProviderSpecificProperty(providerSpecificExpiryTTL); ok && value == "0" {
+		e.DeleteProviderSpecificProperty(providerSpecificExpiryTTL)
+	}
+	if value, ok := e.GetProviderSpecificProperty(providerSpecificZone); ok {
+		if zone, found := p.reportedZones.find(e.DNSName); found && strings.EqualFold(zone, strings.TrimSuffix(value, ".")) {
+			e.DeleteProviderSpecificProperty(providerSpecificZone)
+		}
+	}
+}
+
+// endpointKey identifies the endpoints of a name and record type.
+func endpointKey(e *endpoint.Endpoint) string {
+	return strings.ToLower(strings.TrimSuffix(e.DNSName, ".")) + "/" + e.RecordType
+}
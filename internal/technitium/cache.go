@@ -0,0 +1,293 @@
+package technitium
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	sdk "github.com/chrisatcho/external-dns-technitiumdns-webhook/pkg/sdk"
+)
+
+// recordCache keeps the records listed by the last Records call for a while,
+// so syncs do not list every zone again. The zones are still listed on every
+// call, a zone whose SOA serial or modification time changed out of band
+// refreshes the whole cache.
+type recordCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	valid   bool
+	fetched time.Time
+	records []sdk.Record
+	// zones holds the state of the managed zones by lower case name
+	zones map[string]zoneState
+	// pending counts the changes mirrored per zone since the zone states
+	// were taken
+	pending map[string]int
+}
+
+// zoneState is what tells a zone changed since it was listed
+type zoneState struct {
+	serial       int
+	lastModified time.Time
+}
+
+func newRecordCache(ttl time.Duration) *recordCache {
+	return &recordCache{ttl: ttl}
+}
+
+// get returns the cached records, listing them all again when the cache
+// expired or a zone changed.
+func (c *recordCache) get(ctx context.Context, client DnsService) ([]sdk.Record, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	zones, err := client.GetZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	states := zoneStates(zones)
+	if c.valid && time.Since(c.fetched) < c.ttl {
+		if sameZoneStates(c.zones, states) {
+			return slices.Clone(c.records), nil
+		}
+		log.Debugf("Zones changed since they were listed, refreshing the record cache")
+	}
+
+	// the zones are listed before the records, so changes made while listing
+	// refresh the cache again next time
+	records, err := client.GetRecords(ctx)
+	if err != nil {
+		c.valid = false
+		return nil, err
+	}
+	c.valid = true
+	c.fetched = time.Now()
+	c.records = records
+	c.zones = states
+	c.pending = nil
+	return slices.Clone(records), nil
+}
+
+// add mirrors a created record.
+func (c *recordCache) add(r sdk.Record) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.records = append(c.records, r)
+	c.count(r)
+}
+
+// remove mirrors a deleted record.
+func (c *recordCache) remove(r sdk.Record) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.records = slices.DeleteFunc(c.records, func(cached sdk.Record) bool {
+		return sameRecord(cached, r)
+	})
+	c.count(r)
+}
+
+// replace mirrors a record updated in place.
+func (c *recordCache) replace(old, r sdk.Record) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.count(old)
+	for i := range c.records {
+		if sameRecord(c.records[i], old) {
+			c.records[i] = r
+			return
+		}
+	}
+	c.records = append(c.records, r)
+}
+
+// count records a change of the zone of r, which bumps its serial once.
+func (c *recordCache) count(r sdk.Record) {
+	if c.pending == nil {
+		c.pending = make(map[string]int)
+	}
+	c.pending[strings.ToLower(strings.TrimSuffix(r.Zone, "."))]++
+}
+
+// invalidate drops the cached records, they are listed again next time.
+func (c *recordCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.drop()
+}
+
+func (c *recordCache) drop() {
+	c.valid = false
+	c.records = nil
+	c.pending = nil
+}
+
+// commit takes the current zone states as the new baseline after the
+// mirrored changes were applied, as they changed the serials themselves. A
+// zone whose serial moved by anything else than the number of mirrored
+// changes was also changed out of band, which drops the cache.
+func (c *recordCache) commit(ctx context.Context, client DnsService) {
+	zones, err := client.GetZones(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.valid {
+		return
+	}
+	if err != nil {
+		log.Debugf("Failed to list zones after applying changes, dropping the record cache: %v", err)
+		c.drop()
+		return
+	}
+
+	expected := make(map[string]zoneState, len(c.zones))
+	for name, state := range c.zones {
+		expected[name] = state
+	}
+	for _, zone := range zones {
+		name := zoneKey(zone)
+		changes := c.pending[name]
+		if changes == 0 {
+			continue
+		}
+		state, known := newZoneState(zone)
+		previous, ok := c.zones[name]
+		if !known || !ok || zone.SOASerial == nil || state.serial != previous.serial+changes {
+			log.Debugf("Zone %s changed beyond the applied changes, dropping the record cache", zone.Name)
+			c.drop()
+			return
+		}
+		expected[name] = state
+	}
+	if !sameZoneStates(expected, zoneStates(zones)) {
+		log.Debugf("Zones changed beyond the applied changes, dropping the record cache")
+		c.drop()
+		return
+	}
+	c.zones = expected
+	c.pending = nil
+}
+
+// newZoneState returns the state of zone and whether it is known, i.e.
+// whether Technitium reported the SOA serial or modification time.
+func newZoneState(zone sdk.Zone) (zoneState, bool) {
+	var state zoneState
+	if zone.SOASerial != nil {
+		state.serial = *zone.SOASerial
+	}
+	if zone.LastModified != nil {
+		state.lastModified = *zone.LastModified
+	}
+	return state, zone.SOASerial != nil || zone.LastModified != nil
+}
+
+func zoneStates(zones []sdk.Zone) map[string]zoneState {
+	states := make(map[string]zoneState, len(zones))
+	for _, zone := range zones {
+		states[zoneKey(zone)], _ = newZoneState(zone)
+	}
+	return states
+}
+
+func zoneKey(zone sdk.Zone) string {
+	return strings.ToLower(strings.TrimSuffix(zone.Name, "."))
+}
+
+func sameZoneStates(a, b map[string]zoneState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, state := range a {
+		other, ok := b[name]
+		if !ok || other.serial != state.serial || !other.lastModified.Equal(state.lastModified) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameRecord reports whether a and b are the same record, i.e. have the same
+// name, type and target.
+func sameRecord(a, b sdk.Record) bool {
+	if a.Type != b.Type || !strings.EqualFold(strings.TrimSuffix(a.Name, "."), strings.TrimSuffix(b.Name, ".")) {
+		return false
+	}
+	ta, okA := rdataToTarget(a)
+	tb, okB := rdataToTarget(b)
+	return okA && okB && targetKey(a.Type, ta) == targetKey(b.Type, tb)
+}
+
+// zoneRecords keeps the records listed per zone along with the state of the
+// zone they were listed at, so only the zones that changed since are listed
+// again.
+type zoneRecords struct {
+	mu    sync.Mutex
+	zones map[string]zoneRecordSet
+}
+
+type zoneRecordSet struct {
+	state   zoneState
+	records []sdk.Record
+}
+
+func newZoneRecords() *zoneRecords {
+	return &zoneRecords{zones: make(map[string]zoneRecordSet)}
+}
+
+// get returns the records of zone when it did not change since they were
+// listed. Zones of unknown state are always listed again.
+func (z *zoneRecords) get(zone sdk.Zone) ([]sdk.Record, bool) {
+	if z == nil {
+		return nil, false
+	}
+	state, ok := newZoneState(zone)
+	if !ok {
+		return nil, false
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	set, ok := z.zones[zoneKey(zone)]
+	if !ok || set.state.serial != state.serial || !set.state.lastModified.Equal(state.lastModified) {
+		return nil, false
+	}
+	return set.records, true
+}
+
+// set keeps the records of zone listed at the state of zone.
+func (z *zoneRecords) set(zone sdk.Zone, records []sdk.Record) {
+	if z == nil {
+		return
+	}
+	state, ok := newZoneState(zone)
+	if !ok {
+		return
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	z.zones[zoneKey(zone)] = zoneRecordSet{state: state, records: records}
+}
+
+// retain drops the records of the zones no longer listed.
+func (z *zoneRecords) retain(zones []sdk.Zone) {
+	if z == nil {
+		return
+	}
+	listed := make(map[string]bool, len(zones))
+	for _, zone := range zones {
+		listed[zoneKey(zone)] = true
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	for name := range z.zones {
+		if !listed[name] {
+			delete(z.zones, name)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package technitium
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"sigs.k8s.io/external-dns/endpoint"
+
+	sdk "github.com/chrisatcho/external-dns-technitiumdns-webhook/pkg/sdk"
+)
+
+// commentMarker starts the comments of the records written by the webhook,
+// telling them apart from records edited by hand.
+const commentMarker = "[external-dns]"
+
+// defaultCommentTemplate is the comment template used unless configured.
+const defaultCommentTemplate = "{{with .OwnerID}}owner={{.}} {{end}}{{with .Resource}}resource={{.}} {{end}}updated={{.Timestamp}}"
+
+// commentData is the data the comment template is executed with.
+type commentData struct {
+	OwnerID    string
+	Resource   string
+	DNSName    string
+	RecordType string
+	Timestamp  string
+}
+
+// parseCommentTemplate parses the comment template of the configuration.
+func parseCommentTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = defaultCommentTemplate
+	}
+	return template.New("comment").Option("missingkey=error").Parse(text)
+}
+
+// stampComments sets the marked comment of the records of e, when enabled.
+func (p *Provider) stampComments(e *endpoint.Endpoint, rs []sdk.Record) error {
+	if p.comments == nil {
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString(commentMarker + " ")
+	err := p.comments.Execute(&b, commentData{
+		OwnerID:    e.Labels[endpoint.OwnerLabelKey],
+		Resource:   e.Labels[endpoint.ResourceLabelKey],
+		DNSName:    e.DNSName,
+		RecordType: e.RecordType,
+		Timestamp:  time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return fmt.Errorf("render comment: %w", err)
+	}
+
+	// the comment set through the comments property follows the marker line
+	comment := strings.TrimSpace(b.String())
+	for i := range rs {
+		if rs[i].Comments != "" {
+			rs[i].Comments = comment + "\n" + rs[i].Comments
+		} else {
+			rs[i].Comments = comment
+		}
+	}
+	return nil
+}
+
+// checkMarked refuses changes to the records of e unless they carry the
+// marker, when unmarked records are protected.
+func (p *Provider) checkMarked(e *endpoint.Endpoint) error {
+	if !p.protectUnmarked {
+		return nil
+	}
+	if comment, _ := e.GetProviderSpecificProperty(providerSpecificComments); !isMarked(comment) {
+		return fmt.Errorf("refusing to delete records not marked as managed by external-dns")
+	}
+	return nil
+}
+
+// userComment returns comment without the marker line.
+func userComment(comment string) string {
+	if !isMarked(comment) {
+		return comment
+	}
+	_, user, _ := strings.Cut(comment, "\n")
+	return user
+}
+
+// isMarked reports whether comment was written by the webhook.
+func isMarked(comment string) bool {
+	return strings.HasPrefix(comment, commentMarker)
+}
@@ -0,0 +1,28 @@
+package technitium
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "technitium_webhook"
+
+var (
+	// skippedZones flags the zones left out of the last best effort record
+	// listing.
+	skippedZones = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "skipped_zones",
+		Help:      "Zones skipped by the last best effort record listing because their records could not be fetched.",
+	}, []string{"zone"})
+
+	// zoneListErrors counts failed record listings per zone.
+	zoneListErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "zone_list_errors_total",
+		Help:      "Number of failed record listings per zone.",
+	}, []string{"zone"})
+)
+
+func init() {
+	prometheus.MustRegister(skippedZones, zoneListErrors)
+}
@@ -0,0 +1,105 @@
+package technitium
+
+import (
+	"fmt"
+	"strconv"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// Provider specific properties understood by the provider. ExternalDNS maps
+// the annotation external-dns.alpha.kubernetes.io/webhook-<name> to the
+// property webhook/<name>.
+const (
+	// providerSpecificGlue holds the glue addresses of NS records as a comma
+	// separated list of nameserver=address pairs.
+	providerSpecificGlue = "webhook/technitium-glue"
+
+	// providerSpecificPTR enables or disables the reverse PTR record of A and
+	// AAAA records, overriding TECHNITIUM_CREATE_PTR.
+	providerSpecificPTR = "webhook/technitium-ptr"
+
+	// providerSpecificCreatePTRZone controls whether a missing reverse zone
+	// is created along with a PTR record, which it is by default. It only
+	// applies when records are written and is never reported.
+	providerSpecificCreatePTRZone = "webhook/technitium-create-ptr-zone"
+
+	// providerSpecificZone places the records in the given zone instead of
+	// the most specific zone hosting the name.
+	providerSpecificZone = "webhook/technitium-zone"
+
+	// providerSpecificExpiryTTL is the number of seconds after which
+	// Technitium deletes the records automatically, 0 for never.
+	providerSpecificExpiryTTL = "webhook/technitium-expiry-ttl"
+
+	// providerSpecificDisabled disables the records, so they are kept but
+	// not served.
+	providerSpecificDisabled = "webhook/technitium-disabled"
+
+	// providerSpecificComments holds the comments of the records, which
+	// carry the ownership marker of the records written by the webhook.
+	providerSpecificComments = "webhook/technitium-comments"
+)
+
+// reportedProperties are the properties Records reports from the state of the
+// records in Technitium rather than from the endpoint that created them.
+var reportedProperties = []string{providerSpecificComments, providerSpecificZone, providerSpecificDisabled}
+
+// comparedProperties are the properties whose changes are applied to
+// existing records.
+var comparedProperties = []string{
+	providerSpecificGlue,
+	providerSpecificPTR,
+	providerSpecificComments,
+	providerSpecificZone,
+	providerSpecificExpiryTTL,
+	providerSpecificDisabled,
+}
+
+// recordOptions are the record options set through provider specific
+// properties.
+type recordOptions struct {
+	// comments is the comment of the records without the marker line
+	comments  string
+	expiryTTL int
+	disabled  bool
+}
+
+// endpointOptions parses the record options of e.
+func endpointOptions(e *endpoint.Endpoint) (recordOptions, error) {
+	var o recordOptions
+	if value, ok := e.GetProviderSpecificProperty(providerSpecificComments); ok {
+		o.comments = userComment(value)
+	}
+	if value, ok := e.GetProviderSpecificProperty(providerSpecificExpiryTTL); ok {
+		expiryTTL, err := strconv.Atoi(value)
+		if err != nil || expiryTTL < 0 {
+			return o, fmt.Errorf("invalid %s property %q: must be a number of seconds", providerSpecificExpiryTTL, value)
+		}
+		o.expiryTTL = expiryTTL
+	}
+	if value, ok := e.GetProviderSpecificProperty(providerSpecificDisabled); ok {
+		disabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return o, fmt.Errorf("invalid %s property %q: %w", providerSpecificDisabled, value, err)
+		}
+		o.disabled = disabled
+	}
+	return o, nil
+}
+
+// sameProperties reports whether a and b have the same compared properties.
+// Comments are compared without their marker line.
+func sameProperties(a, b *endpoint.Endpoint) bool {
+	for _, name := range comparedProperties {
+		valueA, _ := a.GetProviderSpecificProperty(name)
+		valueB, _ := b.GetProviderSpecificProperty(name)
+		if name == providerSpecificComments {
+			valueA, valueB = userComment(valueA), userComment(valueB)
+		}
+		if valueA != valueB {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,128 @@
+package technitium
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+
+	sdk "github.com/chrisatcho/external-dns-technitiumdns-webhook/pkg/sdk"
+)
+
+// ptrOptions are the PTR settings of the records of an endpoint.
+type ptrOptions struct {
+	// enabled manages the reverse PTR records
+	enabled bool
+	// createZone creates the reverse zone when missing
+	createZone bool
+}
+
+// endpointPTR returns the PTR settings of e. The reverse zone is created
+// when PTR records are enabled unless the create-ptr-zone property says
+// otherwise.
+func (p *Provider) endpointPTR(e *endpoint.Endpoint) (ptrOptions, error) {
+	enabled, err := p.ptrEnabled(e)
+	if err != nil || !enabled {
+		return ptrOptions{}, err
+	}
+
+	ptr := ptrOptions{enabled: true, createZone: true}
+	if value, ok := e.GetProviderSpecificProperty(providerSpecificCreatePTRZone); ok {
+		if ptr.createZone, err = strconv.ParseBool(value); err != nil {
+			return ptrOptions{}, fmt.Errorf("invalid %s property %q: %w", providerSpecificCreatePTRZone, value, err)
+		}
+	}
+	return ptr, nil
+}
+
+// ptrEnabled reports whether reverse PTR records are managed for e, the
+// ptr property overrides the global setting.
+func (p *Provider) ptrEnabled(e *endpoint.Endpoint) (bool, error) {
+	if e.RecordType != "A" && e.RecordType != "AAAA" {
+		return false, nil
+	}
+
+	value, ok := e.GetProviderSpecificProperty(providerSpecificPTR)
+	if !ok {
+		return p.createPTR, nil
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s property %q: %w", providerSpecificPTR, value, err)
+	}
+	return enabled, nil
+}
+
+// ptrRecord returns the PTR record pointing the address of r back to its name.
+func ptrRecord(r sdk.Record) (sdk.Record, error) {
+	name, err := reverseName(*r.RData.IPAddress)
+	if err != nil {
+		return sdk.Record{}, err
+	}
+
+	ptrName := r.Name
+	return sdk.Record{
+		Name:  name,
+		Type:  "PTR",
+		RData: sdk.RData{PTRName: &ptrName},
+	}, nil
+}
+
+// reverseName returns the in-addr.arpa or ip6.arpa name of an address.
+func reverseName(address string) (string, error) {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return "", fmt.Errorf("invalid IP address %q", address)
+	}
+
+	if v4 := ip.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", v4[3], v4[2], v4[1], v4[0]), nil
+	}
+
+	const hex = "0123456789abcdef"
+	labels := make([]string, 0, 2*net.IPv6len+1)
+	for i := net.IPv6len - 1; i >= 0; i-- {
+		labels = append(labels, string(hex[ip[i]&0x0f]), string(hex[ip[i]>>4]))
+	}
+	labels = append(labels, "ip6.arpa")
+
+	return strings.Join(labels, "."), nil
+}
+
+// ptrIndex maps reverse names to the names their PTR records point to.
+type ptrIndex map[string][]string
+
+// newPTRIndex indexes the PTR records among records.
+func newPTRIndex(records []sdk.Record) ptrIndex {
+	index := ptrIndex{}
+	for _, r := range records {
+		if r.Type != "PTR" || r.RData.PTRName == nil {
+			continue
+		}
+		name := strings.ToLower(r.Name)
+		index[name] = append(index[name], strings.ToLower(strings.TrimSuffix(*r.RData.PTRName, ".")))
+	}
+	return index
+}
+
+// has reports whether a PTR record points the address of r back to its name.
+func (idx ptrIndex) has(r sdk.Record) bool {
+	if (r.Type != "A" && r.Type != "AAAA") || r.RData.IPAddress == nil {
+		return false
+	}
+
+	name, err := reverseName(*r.RData.IPAddress)
+	if err != nil {
+		return false
+	}
+
+	for _, ptrName := range idx[name] {
+		if strings.EqualFold(ptrName, r.Name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,372 @@
+package technitium
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"sigs.k8s.io/external-dns/endpoint"
+
+	sdk "github.com/chrisatcho/external-dns-technitiumdns-webhook/pkg/sdk"
+)
+
+// endpointToRecords converts an endpoint to a slice of records, one per target.
+func endpointToRecords(endpoint *endpoint.Endpoint) ([]sdk.Record, error) {
+	records := make([]sdk.Record, 0)
+
+	options, err := endpointOptions(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	var glue map[string][]string
+	if value, ok := endpoint.GetProviderSpecificProperty(providerSpecificGlue); ok && endpoint.RecordType == "NS" {
+		var err error
+		if glue, err = parseGlue(value); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, target := range endpoint.Targets {
+		rdata, err := targetToRData(endpoint.RecordType, target)
+		if err != nil {
+			return nil, err
+		}
+		rdata.Glue = glue[strings.ToLower(strings.TrimSuffix(target, "."))]
+
+		record := sdk.Record{
+			Name:      endpoint.DNSName,
+			Type:      endpoint.RecordType,
+			RData:     rdata,
+			Comments:  options.comments,
+			ExpiryTTL: options.expiryTTL,
+			Disabled:  options.disabled,
+		}
+
+		ttl := int(endpoint.RecordTTL)
+		if ttl != 0 {
+			record.TTL = ttl
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// recordToRequest converts a record to the request creating it.
+func recordToRequest(r sdk.Record) *sdk.RecordRequest {
+	ttl, expiryTTL, disable := r.TTL, r.ExpiryTTL, r.Disabled
+	req := &sdk.RecordRequest{
+		Domain:    r.Name,
+		Type:      r.Type,
+		TTL:       &ttl,
+		ExpiryTTL: &expiryTTL,
+		Disable:   &disable,
+	}
+	if r.Zone != "" {
+		zone := r.Zone
+		req.Zone = &zone
+	}
+	if r.Comments != "" {
+		comments := r.Comments
+		req.Comments = &comments
+	}
+
+	switch r.Type {
+	case "A", "AAAA":
+		req.IPAddress = r.RData.IPAddress
+	case "CNAME":
+		req.CNAME = r.RData.CNAME
+	case "NS":
+		req.NameServer = r.RData.NameServer
+		if len(r.RData.Glue) > 0 {
+			glue := strings.Join(r.RData.Glue, ",")
+			req.Glue = &glue
+		}
+	case "TXT":
+		req.Text = r.RData.Text
+		// character strings are limited to 255 bytes, Technitium stores
+		// every line of split text as its own string
+		if r.RData.Text != nil && len(*r.RData.Text) > maxTXTString {
+			text := strings.Join(splitTXT(*r.RData.Text), "\n")
+			split := true
+			req.Text = &text
+			req.SplitText = &split
+		}
+	case "MX":
+		req.Preference = r.RData.Preference
+		req.Exchange = r.RData.Exchange
+	case "SRV":
+		req.Priority = r.RData.Priority
+		req.Weight = r.RData.Weight
+		req.Port = r.RData.Port
+		req.Target = r.RData.Target
+	case "CAA":
+		req.Flags = r.RData.Flags
+		req.Tag = r.RData.Tag
+		req.Value = r.RData.Value
+	}
+
+	return req
+}
+
+// recordToEndpoint converts a record to an endpoint. It returns nil for
+// unsupported record types.
+func recordToEndpoint(r sdk.Record) *endpoint.Endpoint {
+	target, ok := rdataToTarget(r)
+	if !ok {
+		return nil
+	}
+
+	e := endpoint.NewEndpointWithTTL(r.Name, r.Type, endpoint.TTL(r.TTL), target)
+	if e != nil && r.Type == "NS" && len(r.RData.Glue) > 0 {
+		e.SetProviderSpecificProperty(providerSpecificGlue, formatGlue(target, r.RData.Glue))
+	}
+	if e != nil && r.Comments != "" {
+		e.SetProviderSpecificProperty(providerSpecificComments, r.Comments)
+	}
+	if e != nil && r.ExpiryTTL > 0 {
+		e.SetProviderSpecificProperty(providerSpecificExpiryTTL, strconv.Itoa(r.ExpiryTTL))
+	}
+	if e != nil && r.Disabled {
+		e.SetProviderSpecificProperty(providerSpecificDisabled, "true")
+	}
+
+	return e
+}
+
+// targetToRData parses an external-dns target into record data of the given type.
+func targetToRData(recordType, target string) (sdk.RData, error) {
+	rdata := sdk.RData{}
+
+	switch recordType {
+	case "A", "AAAA":
+		rdata.IPAddress = &target
+	case "CNAME":
+		rdata.CNAME = &target
+	case "NS":
+		rdata.NameServer = &target
+	case "TXT":
+		rdata.Text = &target
+	case "MX":
+		// "preference exchange"
+		fields := strings.Fields(target)
+		if len(fields) != 2 {
+			return rdata, fmt.Errorf("invalid MX target %q, expected \"preference exchange\"", target)
+		}
+		preference, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return rdata, fmt.Errorf("invalid MX preference in %q: %w", target, err)
+		}
+		rdata.Preference = &preference
+		rdata.Exchange = &fields[1]
+	case "SRV":
+		// "priority weight port target"
+		fields := strings.Fields(target)
+		if len(fields) != 4 {
+			return rdata, fmt.Errorf("invalid SRV target %q, expected \"priority weight port target\"", target)
+		}
+		values := make([]int, 3)
+		for i := range values {
+			v, err := strconv.Atoi(fields[i])
+			if err != nil {
+				return rdata, fmt.Errorf("invalid SRV target %q: %w", target, err)
+			}
+			values[i] = v
+		}
+		rdata.Priority = &values[0]
+		rdata.Weight = &values[1]
+		rdata.Port = &values[2]
+		rdata.Target = &fields[3]
+	case "CAA":
+		flags, tag, value, err := parseCAA(target)
+		if err != nil {
+			return rdata, err
+		}
+		rdata.Flags = &flags
+		rdata.Tag = &tag
+		rdata.Value = &value
+	default:
+		return rdata, fmt.Errorf("unsupported record type %s", recordType)
+	}
+
+	return rdata, nil
+}
+
+// rdataToTarget formats the record data as an external-dns target.
+func rdataToTarget(r sdk.Record) (string, bool) {
+	switch r.Type {
+	case "A", "AAAA":
+		if r.RData.IPAddress != nil {
+			return *r.RData.IPAddress, true
+		}
+	case "CNAME":
+		if r.RData.CNAME != nil {
+			return strings.TrimSuffix(*r.RData.CNAME, "."), true
+		}
+	case "NS":
+		if r.RData.NameServer != nil {
+			return strings.TrimSuffix(*r.RData.NameServer, "."), true
+		}
+	case "TXT":
+		if r.RData.Text != nil {
+			if r.RData.SplitText != nil && *r.RData.SplitText {
+				return strings.ReplaceAll(*r.RData.Text, "\n", ""), true
+			}
+			return *r.RData.Text, true
+		}
+	case "MX":
+		if r.RData.Preference != nil && r.RData.Exchange != nil {
+			return fmt.Sprintf("%d %s", *r.RData.Preference, strings.TrimSuffix(*r.RData.Exchange, ".")), true
+		}
+	case "SRV":
+		if r.RData.Priority != nil && r.RData.Weight != nil && r.RData.Port != nil && r.RData.Target != nil {
+			return fmt.Sprintf("%d %d %d %s", *r.RData.Priority, *r.RData.Weight, *r.RData.Port, strings.TrimSuffix(*r.RData.Target, ".")), true
+		}
+	case "CAA":
+		if r.RData.Flags != nil && r.RData.Tag != nil && r.RData.Value != nil {
+			return formatCAA(*r.RData.Flags, *r.RData.Tag, *r.RData.Value), true
+		}
+	}
+	return "", false
+}
+
+// parseGlue parses the glue property, a comma separated list of
+// nameserver=address pairs, into the addresses of each name server.
+func parseGlue(value string) (map[string][]string, error) {
+	glue := map[string][]string{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		ns, address, ok := strings.Cut(pair, "=")
+		if !ok || ns == "" || net.ParseIP(strings.TrimSpace(address)) == nil {
+			return nil, fmt.Errorf("invalid glue %q, expected nameserver=address pairs", pair)
+		}
+		ns = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(ns), "."))
+		glue[ns] = append(glue[ns], strings.TrimSpace(address))
+	}
+	return glue, nil
+}
+
+// formatGlue formats the glue addresses of a name server as the glue property.
+func formatGlue(ns string, addresses []string) string {
+	pairs := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		pairs = append(pairs, ns+"="+address)
+	}
+	return strings.Join(pairs, ",")
+}
+
+// parseCAA parses a CAA target in the `flags tag "value"` presentation format.
+// The value may be unquoted, quoted values support backslash escapes.
+func parseCAA(target string) (int, string, string, error) {
+	fields := strings.SplitN(strings.TrimSpace(target), " ", 3)
+	if len(fields) != 3 {
+		return 0, "", "", fmt.Errorf("invalid CAA target %q, expected `flags tag \"value\"`", target)
+	}
+
+	flags, err := strconv.Atoi(fields[0])
+	if err != nil || flags < 0 || flags > 255 {
+		return 0, "", "", fmt.Errorf("invalid CAA flags in %q", target)
+	}
+
+	tag := fields[1]
+	if tag == "" {
+		return 0, "", "", fmt.Errorf("invalid CAA tag in %q", target)
+	}
+
+	value := strings.TrimSpace(fields[2])
+	if !strings.HasPrefix(value, `"`) {
+		return flags, tag, value, nil
+	}
+
+	var sb strings.Builder
+	escaped := false
+	for i, c := range value[1:] {
+		switch {
+		case escaped:
+			sb.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			if i+2 != len(value) {
+				return 0, "", "", fmt.Errorf("invalid CAA value in %q, unexpected data after closing quote", target)
+			}
+			return flags, tag, sb.String(), nil
+		default:
+			sb.WriteRune(c)
+		}
+	}
+
+	return 0, "", "", fmt.Errorf("invalid CAA value in %q, missing closing quote", target)
+}
+
+// formatCAA formats CAA record data in the `flags tag "value"` presentation
+// format.
+func formatCAA(flags int, tag, value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+	return fmt.Sprintf(`%d %s "%s"`, flags, tag, value)
+}
+
+// mergeEndpoint adds the targets of src to dst, along with their glue. The
+// merged endpoint only keeps a marked comment when all its records have one
+// and is only disabled when all its records are, its other properties are
+// those of its first record.
+func mergeEndpoint(dst, src *endpoint.Endpoint) {
+	if _, ok := src.GetProviderSpecificProperty(providerSpecificDisabled); !ok {
+		dst.DeleteProviderSpecificProperty(providerSpecificDisabled)
+	}
+
+	comment, _ := dst.GetProviderSpecificProperty(providerSpecificComments)
+	srcComment, _ := src.GetProviderSpecificProperty(providerSpecificComments)
+	if isMarked(comment) && !isMarked(srcComment) {
+		if srcComment == "" {
+			dst.DeleteProviderSpecificProperty(providerSpecificComments)
+		} else {
+			dst.SetProviderSpecificProperty(providerSpecificComments, srcComment)
+		}
+	}
+
+	dst.Targets = append(dst.Targets, src.Targets...)
+	if glue, ok := src.GetProviderSpecificProperty(providerSpecificGlue); ok {
+		if existing, ok := dst.GetProviderSpecificProperty(providerSpecificGlue); ok {
+			glue = existing + "," + glue
+		}
+		dst.SetProviderSpecificProperty(providerSpecificGlue, glue)
+	}
+}
+
+// targetKey normalises target for comparison, so differently written IPv6
+// addresses and host names in another case match.
+func targetKey(recordType, target string) string {
+	if recordType == "A" || recordType == "AAAA" {
+		if ip := net.ParseIP(target); ip != nil {
+			return ip.String()
+		}
+	}
+	return strings.ToLower(strings.TrimSuffix(target, "."))
+}
+
+// maxTXTString is the maximum length of a single TXT character string.
+const maxTXTString = 255
+
+// splitTXT splits text into character strings of at most maxTXTString bytes,
+// without cutting UTF-8 sequences in half.
+func splitTXT(text string) []string {
+	var parts []string
+	for len(text) > maxTXTString {
+		cut := maxTXTString
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		parts = append(parts, text[:cut])
+		text = text[cut:]
+	}
+	return append(parts, text)
+}
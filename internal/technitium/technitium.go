@@ -2,7 +2,15 @@ package technitium
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -12,44 +20,186 @@ import (
 	"sigs.k8s.io/external-dns/provider"
 )
 
+// closeTimeout bounds the time spent logging out on shutdown
+const closeTimeout = 10 * time.Second
+
 // Provider implements the DNS provider for Technitium DNS.
 type Provider struct {
 	provider.BaseProvider
 
 	client       DnsService
 	domainFilter endpoint.DomainFilter
+	// createPTR manages reverse PTR records of A and AAAA records unless an
+	// endpoint overrides it.
+	createPTR bool
+	// preservePTR keeps the PTR state of existing records as found, unless
+	// an endpoint sets it.
+	preservePTR bool
+	// transactional undoes the applied changes of a batch when one fails
+	transactional bool
+	// ttl decides the TTL of created and updated records
+	ttl ttlPolicy
+	// comments renders the marked comment of written records, nil when
+	// comments are disabled
+	comments *template.Template
+	// protectUnmarked refuses to delete records without the comment marker
+	protectUnmarked bool
+	// disabledRecords is the policy for disabled records
+	disabledRecords string
+	// cache keeps the listed records between syncs, nil when disabled
+	cache *recordCache
+
+	// reported holds the properties reported by the last Records call, which
+	// AdjustEndpoints copies to desired endpoints lacking them, and
+	// reportedZones the zones the records were listed from
+	reportedMu    sync.Mutex
+	reported      map[string][]endpoint.ProviderSpecificProperty
+	reportedZones zoneIndex
+	// hidden holds the disabled records the last Records call left out in
+	// hide mode, which are enabled rather than created again
+	hidden []sdk.Record
 }
 
 // Configuration holds configuration from environmental variables
 type Configuration struct {
-	User           string `env:"TECHNITIUM_USER,notEmpty"`
-	Pass           string `env:"TECHNITIUM_PASS,notEmpty"`
-	APIEndpointURL string `env:"TECHNITIUM_API_URL,notEmpty"`
-	Debug          bool   `env:"TECHNITIUM_DEBUG" envDefault:"false"`
+	User             string         `env:"TECHNITIUM_USER"`
+	Pass             string         `env:"TECHNITIUM_PASS"`
+	Token            string         `env:"TECHNITIUM_TOKEN"`
+	APIEndpointURL   string         `env:"TECHNITIUM_API_URL,notEmpty"`
+	Debug            bool           `env:"TECHNITIUM_DEBUG" envDefault:"false"`
+	BestEffort       bool           `env:"TECHNITIUM_BEST_EFFORT" envDefault:"false"`
+	CreatePTR        bool           `env:"TECHNITIUM_CREATE_PTR" envDefault:"false"`
+	PreservePTR      bool           `env:"TECHNITIUM_PRESERVE_PTR" envDefault:"false"`
+	Transactional    bool           `env:"TECHNITIUM_TRANSACTIONAL" envDefault:"false"`
+	DefaultTTL       int            `env:"TECHNITIUM_DEFAULT_TTL" envDefault:"3600"`
+	MinTTL           int            `env:"TECHNITIUM_MIN_TTL" envDefault:"0"`
+	MaxTTL           int            `env:"TECHNITIUM_MAX_TTL" envDefault:"0"`
+	ZoneTTLs         map[string]int `env:"TECHNITIUM_ZONE_TTLS"`
+	Comments         bool           `env:"TECHNITIUM_COMMENTS" envDefault:"true"`
+	CommentTemplate  string         `env:"TECHNITIUM_COMMENT_TEMPLATE"`
+	ProtectUnmarked  bool           `env:"TECHNITIUM_PROTECT_UNMARKED" envDefault:"false"`
+	DisabledRecords  string         `env:"TECHNITIUM_DISABLED_RECORDS" envDefault:"report"`
+	ZoneTypes        []string       `env:"TECHNITIUM_ZONE_TYPES" envDefault:"Primary,Forwarder"`
+	ExcludeZoneTypes []string       `env:"TECHNITIUM_EXCLUDE_ZONE_TYPES"`
+	ListConcurrency  int            `env:"TECHNITIUM_LIST_CONCURRENCY" envDefault:"8"`
+	ZonesPerPage     int            `env:"TECHNITIUM_ZONES_PER_PAGE" envDefault:"100"`
+	RetryAttempts    int            `env:"TECHNITIUM_RETRY_ATTEMPTS" envDefault:"3"`
+	RetryTimeout     time.Duration  `env:"TECHNITIUM_RETRY_TIMEOUT" envDefault:"30s"`
+	CacheTTL         time.Duration  `env:"TECHNITIUM_CACHE_TTL" envDefault:"0s"`
+	IncrementalSync  bool           `env:"TECHNITIUM_INCREMENTAL_SYNC" envDefault:"true"`
+}
+
+// Policies for records disabled in Technitium
+const (
+	// disabledHide leaves disabled records out of Records, as if they did
+	// not exist
+	disabledHide = "hide"
+	// disabledReport reports disabled records with the disabled property and
+	// keeps them disabled
+	disabledReport = "report"
+	// disabledEnable reports disabled records with the disabled property, so
+	// they are enabled again unless the endpoint disables them
+	disabledEnable = "enable"
+)
+
+// Validate checks that exactly one authentication mode is configured and
+// that the TTL policy, comment template, disabled records policy and zone
+// types are valid
+func (c *Configuration) Validate() error {
+	if err := validZoneTypes(c.ZoneTypes); err != nil {
+		return fmt.Errorf("TECHNITIUM_ZONE_TYPES: %w", err)
+	}
+	if err := validZoneTypes(c.ExcludeZoneTypes); err != nil {
+		return fmt.Errorf("TECHNITIUM_EXCLUDE_ZONE_TYPES: %w", err)
+	}
+	switch c.DisabledRecords {
+	case "", disabledHide, disabledReport, disabledEnable:
+	default:
+		return fmt.Errorf("TECHNITIUM_DISABLED_RECORDS must be one of %s, %s or %s, got %q", disabledHide, disabledReport, disabledEnable, c.DisabledRecords)
+	}
+	if _, err := parseCommentTemplate(c.CommentTemplate); err != nil {
+		return fmt.Errorf("TECHNITIUM_COMMENT_TEMPLATE: %w", err)
+	}
+	if c.ProtectUnmarked && !c.Comments {
+		return fmt.Errorf("TECHNITIUM_PROTECT_UNMARKED requires TECHNITIUM_COMMENTS")
+	}
+	if c.ListConcurrency < 0 {
+		return fmt.Errorf("TECHNITIUM_LIST_CONCURRENCY cannot be negative")
+	}
+	if c.ZonesPerPage < 0 {
+		return fmt.Errorf("TECHNITIUM_ZONES_PER_PAGE cannot be negative")
+	}
+	if c.RetryAttempts < 0 || c.RetryTimeout < 0 {
+		return fmt.Errorf("TECHNITIUM_RETRY_ATTEMPTS and TECHNITIUM_RETRY_TIMEOUT cannot be negative")
+	}
+	if c.CacheTTL < 0 {
+		return fmt.Errorf("TECHNITIUM_CACHE_TTL cannot be negative")
+	}
+	if c.DefaultTTL < 0 || c.MinTTL < 0 || c.MaxTTL < 0 {
+		return fmt.Errorf("TECHNITIUM_DEFAULT_TTL, TECHNITIUM_MIN_TTL and TECHNITIUM_MAX_TTL cannot be negative")
+	}
+	if c.MaxTTL > 0 && c.MinTTL > c.MaxTTL {
+		return fmt.Errorf("TECHNITIUM_MIN_TTL %d is greater than TECHNITIUM_MAX_TTL %d", c.MinTTL, c.MaxTTL)
+	}
+	for zone, ttl := range c.ZoneTTLs {
+		if ttl <= 0 {
+			return fmt.Errorf("TECHNITIUM_ZONE_TTLS: TTL of zone %s must be positive", zone)
+		}
+	}
+
+	if c.Token != "" {
+		if c.User != "" || c.Pass != "" {
+			return fmt.Errorf("TECHNITIUM_TOKEN cannot be combined with TECHNITIUM_USER and TECHNITIUM_PASS")
+		}
+		return nil
+	}
+
+	if c.User == "" || c.Pass == "" {
+		return fmt.Errorf("either TECHNITIUM_TOKEN or both TECHNITIUM_USER and TECHNITIUM_PASS must be set")
+	}
+
+	return nil
 }
 
 // DnsService interface to the dns backend, also needed for creating mocks in tests
 type DnsService interface {
-	GetZones() ([]sdk.Zone, error)
-	GetRecords() ([]sdk.Record, error)
-	CreateRecord(records *sdk.RecordRequest) error
-	DeleteRecord(record *sdk.Record) error
+	GetZones(ctx context.Context) ([]sdk.Zone, error)
+	GetRecords(ctx context.Context) ([]sdk.Record, error)
+	GetDomainRecords(ctx context.Context, zone, domain string) ([]sdk.Record, error)
+	CreateRecord(ctx context.Context, records *sdk.RecordRequest) error
+	DeleteRecord(ctx context.Context, record *sdk.Record) error
+	UpdateRecord(ctx context.Context, old *sdk.Record, record *sdk.RecordRequest) error
+	EnableRecord(ctx context.Context, record *sdk.Record) error
 }
 
 // DnsClient client of the dns api
 type DnsClient struct {
 	client *sdk.APIClient
+	// bestEffort skips zones whose records cannot be listed instead of
+	// failing the whole listing.
+	bestEffort bool
+	// zones selects the managed zones
+	zones zoneFilter
+	// concurrency bounds the number of zones listed at once, zones are
+	// listed one at a time below 1.
+	concurrency int
+	// zoneRecords keeps the records of every zone between listings, so only
+	// the zones that changed are listed again. Nil lists every zone.
+	zoneRecords *zoneRecords
 }
 
-// GetZones client get zones method
-func (c DnsClient) GetZones() ([]sdk.Zone, error) {
-	zones, _, err := c.client.ZonesAPI.ListZones()
-	return zones, err
+// GetZones client get managed zones method
+func (c DnsClient) GetZones(ctx context.Context) ([]sdk.Zone, error) {
+	zones, _, err := c.client.ZonesAPI.ListZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.zones.filter(zones), nil
 }
 
 // GetZone client get zone method
-func (c DnsClient) GetZone(zoneName string) (*sdk.Zone, error) {
-	zones, _, err := c.client.ZonesAPI.ListZones()
+func (c DnsClient) GetZone(ctx context.Context, zoneName string) (*sdk.Zone, error) {
+	zones, _, err := c.client.ZonesAPI.ListZones(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -63,78 +213,254 @@ func (c DnsClient) GetZone(zoneName string) (*sdk.Zone, error) {
 	return nil, fmt.Errorf("Zone %v not found", zoneName)
 }
 
-// GetRecords client get records method
-func (c DnsClient) GetRecords() ([]sdk.Record, error) {
-	zones, _, err := c.client.ZonesAPI.ListZones()
-	records := make([]sdk.Record, 0)
-	for _, zone := range zones {
-		rs, _, err := c.client.RecordsAPI.ListRecords(zone.Name)
-		if err != nil {
-			return nil, fmt.Errorf("GetRecords: %w", err)
+// GetRecords client get records of the managed zones method. Zones are
+// listed concurrently, at most concurrency at a time, and the records are
+// returned in zone order. Zones whose SOA serial and modification time did
+// not change since the last call are not listed again. The first failing
+// zone aborts the listing, in best effort mode failing zones are skipped
+// instead and reported through the skipped zones metric.
+func (c DnsClient) GetRecords(ctx context.Context) ([]sdk.Record, error) {
+	zones, err := c.GetZones(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("GetRecords: %w", err)
+	}
+
+	skippedZones.Reset()
+	c.zoneRecords.retain(zones)
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	results := make([][]sdk.Record, len(zones))
+	sem := make(chan struct{}, max(c.concurrency, 1))
+	var wg sync.WaitGroup
+	for i, zone := range zones {
+		if rs, ok := c.zoneRecords.get(zone); ok {
+			results[i] = rs
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
 		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			rs, err := c.listZone(ctx, zone)
+			if err != nil {
+				cancel(err)
+				return
+			}
+			results[i] = rs
+		}()
+	}
+	wg.Wait()
+	if err := context.Cause(ctx); err != nil {
+		return nil, fmt.Errorf("GetRecords: %w", err)
+	}
+
+	records := make([]sdk.Record, 0)
+	for _, rs := range results {
 		records = append(records, rs...)
 	}
+	return records, nil
+}
+
+// listZone lists the records of zone. In best effort mode a failing zone is
+// skipped unless the listing was aborted.
+func (c DnsClient) listZone(ctx context.Context, zone sdk.Zone) ([]sdk.Record, error) {
+	rs, _, err := c.client.RecordsAPI.ListRecords(ctx, zone.Name)
+	if err == nil {
+		c.zoneRecords.set(zone, rs)
+		return rs, nil
+	}
+	if ctx.Err() != nil {
+		return nil, err
+	}
+	zoneListErrors.WithLabelValues(zone.Name).Inc()
+	if !c.bestEffort {
+		return nil, fmt.Errorf("zone %s: %w", zone.Name, err)
+	}
+	log.Warnf("Skipping zone %s: %v", zone.Name, err)
+	skippedZones.WithLabelValues(zone.Name).Set(1)
+	return nil, nil
+}
+
+// GetDomainRecords client get records of a single domain method
+func (c DnsClient) GetDomainRecords(ctx context.Context, zone, domain string) ([]sdk.Record, error) {
+	records, _, err := c.client.RecordsAPI.ListDomainRecords(ctx, zone, domain)
 	return records, err
 }
 
 // CreateRecords client create records method
-func (c DnsClient) CreateRecord(record *sdk.RecordRequest) error {
-	_, _, err := c.client.RecordsAPI.CreateRecord(record)
+func (c DnsClient) CreateRecord(ctx context.Context, record *sdk.RecordRequest) error {
+	_, _, err := c.client.RecordsAPI.CreateRecord(ctx, record)
 	return err
 }
 
 // DeleteRecord client delete record method
-func (c DnsClient) DeleteRecord(r *sdk.Record) error {
-	_, err := c.client.RecordsAPI.DeleteRecord(r)
+func (c DnsClient) DeleteRecord(ctx context.Context, r *sdk.Record) error {
+	_, err := c.client.RecordsAPI.DeleteRecord(ctx, r)
+	return err
+}
+
+// UpdateRecord client update record method
+func (c DnsClient) UpdateRecord(ctx context.Context, old *sdk.Record, r *sdk.RecordRequest) error {
+	_, _, err := c.client.RecordsAPI.UpdateRecord(ctx, old, r)
 	return err
 }
 
+// EnableRecord client enable record method
+func (c DnsClient) EnableRecord(ctx context.Context, r *sdk.Record) error {
+	_, _, err := c.client.RecordsAPI.EnableRecord(ctx, r)
+	return err
+}
+
+// Close ends the Technitium session held by the client
+func (c DnsClient) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	return c.client.Logout(ctx)
+}
+
 // NewProvider creates a new Technitium DNS provider.
 func NewProvider(domainFilter endpoint.DomainFilter, configuration *Configuration) *Provider {
 	cfg := &sdk.Configuration{
-		BaseURL: configuration.APIEndpointURL,
-		User:    configuration.User,
-		Pass:    configuration.Pass,
-		Debug:   configuration.Debug,
+		BaseURL:      configuration.APIEndpointURL,
+		User:         configuration.User,
+		Pass:         configuration.Pass,
+		Token:        configuration.Token,
+		Debug:        configuration.Debug,
+		ZonesPerPage: configuration.ZonesPerPage,
+		Retry: sdk.RetryPolicy{
+			MaxAttempts: configuration.RetryAttempts,
+			MaxElapsed:  configuration.RetryTimeout,
+		},
 	}
 	client := sdk.NewAPIClient(cfg)
 
+	dnsClient := DnsClient{
+		client:      client,
+		bestEffort:  configuration.BestEffort,
+		zones:       newZoneFilter(configuration.ZoneTypes, configuration.ExcludeZoneTypes),
+		concurrency: configuration.ListConcurrency,
+	}
+	if configuration.IncrementalSync {
+		dnsClient.zoneRecords = newZoneRecords()
+	}
+
 	prov := &Provider{
-		BaseProvider: *&provider.BaseProvider{},
-		client:       DnsClient{client: client},
-		domainFilter: domainFilter,
+		BaseProvider:    *&provider.BaseProvider{},
+		client:          dnsClient,
+		domainFilter:    domainFilter,
+		createPTR:       configuration.CreatePTR,
+		preservePTR:     configuration.PreservePTR,
+		transactional:   configuration.Transactional,
+		ttl:             newTTLPolicy(configuration),
+		protectUnmarked: configuration.ProtectUnmarked,
+		disabledRecords: configuration.DisabledRecords,
+	}
+	if configuration.CacheTTL > 0 {
+		prov.cache = newRecordCache(configuration.CacheTTL)
+	}
+	if configuration.Comments {
+		comments, err := parseCommentTemplate(configuration.CommentTemplate)
+		if err != nil {
+			log.Errorf("Invalid comment template, comments are disabled: %v", err)
+		}
+		prov.comments = comments
 	}
 
 	return prov
 }
 
-// Records returns the list of resource records in all zones.
+// Close releases the resources held by the provider, such as the Technitium
+// session.
+func (p *Provider) Close() error {
+	if c, ok := p.client.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Records returns the list of resource records in all zones. A failure to
+// list any zone fails the whole call, unless the client runs in best effort
+// mode.
 func (p *Provider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
 	endpoints := make([]*endpoint.Endpoint, 0)
 
-	records, err := p.client.GetRecords()
+	records, err := p.getRecords(ctx)
 	if err != nil {
-		log.Warnf("Failed to fetch records: %v", err)
+		return nil, fmt.Errorf("failed to fetch records: %w", err)
 	}
 
+	// records of the same name and type are merged into a single endpoint,
+	// as that is how ExternalDNS plans them
+	ptrs := newPTRIndex(records)
+	zones := recordZones(records)
+	merged := make(map[string]*endpoint.Endpoint)
+	allPTR := make(map[*endpoint.Endpoint]bool)
+	var hidden []sdk.Record
 	for _, r := range records {
-		endpoint := recordToEndpoint(r)
-		if endpoint == nil {
+		// the zone's own name servers are not ours to manage
+		if isApexNS(r) {
+			continue
+		}
+		if r.Disabled && p.disabledRecords == disabledHide {
+			hidden = append(hidden, r)
 			continue
 		}
 
-		if !p.domainFilter.Match(endpoint.DNSName) {
+		e := recordToEndpoint(r)
+		if e == nil || !p.domainFilter.Match(e.DNSName) {
 			continue
 		}
+		// only report the zone of records placed outside of their most
+		// specific zone
+		if zone, _ := zones.find(r.Name); r.Zone != "" && !strings.EqualFold(zone, r.Zone) {
+			e.SetProviderSpecificProperty(providerSpecificZone, r.Zone)
+		}
 
-		endpoints = append(endpoints, endpoint)
+		key := endpointKey(e)
+		if m, ok := merged[key]; ok {
+			mergeEndpoint(m, e)
+			e = m
+		} else {
+			merged[key] = e
+			endpoints = append(endpoints, e)
+			allPTR[e] = true
+		}
+		if r.Type == "A" || r.Type == "AAAA" {
+			allPTR[e] = allPTR[e] && ptrs.has(r)
+		}
 	}
 
+	// only report the PTR state when it deviates from the global setting, so
+	// endpoints without the property do not show a diff
+	for _, e := range endpoints {
+		if e.RecordType != "A" && e.RecordType != "AAAA" {
+			continue
+		}
+		if hasPTR := allPTR[e]; hasPTR != p.createPTR {
+			e.SetProviderSpecificProperty(providerSpecificPTR, strconv.FormatBool(hasPTR))
+		}
+	}
+
+	p.setReported(endpoints, zones)
+	p.reportedMu.Lock()
+	p.hidden = hidden
+	p.reportedMu.Unlock()
+
 	log.Debugf("Records() found %d endpoints: %v", len(endpoints), endpoints)
 	return endpoints, nil
 }
 
-// ApplyChanges applies a given set of changes.
+// ApplyChanges applies a given set of changes. Every change is attempted, the
+// failed ones are reported together in the returned error. Transactional
+// batches instead stop at the first failure and undo the applied changes.
 func (p *Provider) ApplyChanges(ctx context.Context, changes *plan.Changes) error {
 	if changes == nil {
 		return fmt.Errorf("changes cannot be nil")
@@ -147,87 +473,437 @@ func (p *Provider) ApplyChanges(ctx context.Context, changes *plan.Changes) erro
 	toDelete := make([]*endpoint.Endpoint, len(changes.Delete))
 	copy(toDelete, changes.Delete)
 
+	var toUpdateOld, toUpdateNew []*endpoint.Endpoint
 	for i, updateOldEndpoint := range changes.UpdateOld {
 		if !sameEndpoints(*updateOldEndpoint, *changes.UpdateNew[i]) {
-			toDelete = append(toDelete, updateOldEndpoint)
-			toCreate = append(toCreate, changes.UpdateNew[i])
+			toUpdateOld = append(toUpdateOld, updateOldEndpoint)
+			toUpdateNew = append(toUpdateNew, changes.UpdateNew[i])
 		}
 	}
 
-	for _, e := range toDelete {
-		rs := endpointToRecords(e)
-		for _, r := range rs {
-			p.client.DeleteRecord(&r)
+	zones, err := p.zoneIndex(ctx)
+	if err != nil {
+		return err
+	}
+
+	result := &changeBatch{}
+	if p.transactional {
+		result.journal = &journal{}
+		result.snapshot, err = p.takeSnapshot(ctx, zones, slices.Concat(toDelete, toUpdateOld))
+		if err != nil {
+			return err
 		}
 	}
 
+	for _, e := range toDelete {
+		p.deleteEndpoint(ctx, zones, e, result)
+	}
+	for i, e := range toUpdateOld {
+		p.updateEndpoint(ctx, zones, e, toUpdateNew[i], result)
+	}
 	for _, e := range toCreate {
-		ttl := int(e.RecordTTL)
-		for _, t := range e.Targets {
-			ipAddress := t
-			r := &sdk.RecordRequest{
-				Domain:    e.DNSName,
-				Type:      e.RecordType,
-				TTL:       &ttl,
-				IPAddress: &ipAddress,
-			}
-			p.client.CreateRecord(r)
+		p.createEndpoint(ctx, zones, e, result)
+	}
+
+	err = result.err()
+	if p.cache != nil && result.total > 0 {
+		if err != nil {
+			// rolled back or partially applied, the cache cannot tell
+			p.cache.invalidate()
+		} else {
+			p.cache.commit(ctx, p.client)
 		}
 	}
+	if err == nil || result.journal == nil {
+		return err
+	}
+	if rollbackErr := result.journal.rollback(ctx); rollbackErr != nil {
+		return errors.Join(err, rollbackErr)
+	}
+	return fmt.Errorf("%w, rolled back %d applied changes", err, len(result.journal.entries))
+}
 
-	return nil
+// deleteEndpoint deletes the records of e, along with their PTR records when
+// enabled.
+func (p *Provider) deleteEndpoint(ctx context.Context, zones zoneIndex, e *endpoint.Endpoint, result *changeBatch) {
+	if err := checkApexNS(zones, e, "delete"); err != nil {
+		result.add(err)
+		return
+	}
+	if err := p.checkMarked(e); err != nil {
+		result.add(fmt.Errorf("delete %s %s: %w", e.DNSName, e.RecordType, err))
+		return
+	}
+
+	rs, ptr, err := p.endpointRecords(zones, e)
+	if err != nil {
+		result.add(fmt.Errorf("delete %s %s: %w", e.DNSName, e.RecordType, err))
+		return
+	}
+
+	for i, r := range rs {
+		p.deleteRecord(ctx, zones, e, e.Targets[i], r, ptr, result)
+	}
 }
 
-// endpointToRecords converts an endpoint to a slice of records.
-func endpointToRecords(endpoint *endpoint.Endpoint) []sdk.Record {
-	records := make([]sdk.Record, 0)
+// deleteRecord deletes the record r of the target of e, along with its PTR
+// record when enabled.
+func (p *Provider) deleteRecord(ctx context.Context, zones zoneIndex, e *endpoint.Endpoint, target string, r sdk.Record, ptr ptrOptions, result *changeBatch) {
+	if result.stopped() {
+		return
+	}
+	if err := p.client.DeleteRecord(ctx, &r); err != nil {
+		result.add(fmt.Errorf("delete %s %s %s: %w", e.DNSName, e.RecordType, target, err))
+		return
+	}
+	result.add(nil)
+	p.cacheChange(ptr, func(c *recordCache) { c.remove(r) })
+	original := result.snapshot.find(r)
+	result.journal.record(fmt.Sprintf("delete %s %s %s", e.DNSName, e.RecordType, target), func(ctx context.Context) error {
+		return p.client.CreateRecord(ctx, recordRequest(original, ptr))
+	})
+
+	if ptr.enabled {
+		if err := p.deletePTR(ctx, zones, r); err != nil {
+			result.add(fmt.Errorf("delete PTR of %s %s %s: %w", e.DNSName, e.RecordType, target, err))
+			return
+		}
+		result.add(nil)
+	}
+}
 
-	for _, target := range endpoint.Targets {
-		record := &sdk.Record{}
+// createEndpoint creates the records of e, along with their PTR records when
+// enabled.
+func (p *Provider) createEndpoint(ctx context.Context, zones zoneIndex, e *endpoint.Endpoint, result *changeBatch) {
+	if err := checkApexNS(zones, e, "create"); err != nil {
+		result.add(err)
+		return
+	}
+	rs, ptr, err := p.endpointRecords(zones, e)
+	if err != nil {
+		result.add(fmt.Errorf("create %s %s: %w", e.DNSName, e.RecordType, err))
+		return
+	}
+	p.applyTTL(rs)
+	if err := p.stampComments(e, rs); err != nil {
+		result.add(fmt.Errorf("create %s %s: %w", e.DNSName, e.RecordType, err))
+		return
+	}
 
-		record.Name = endpoint.DNSName
-		record.Type = endpoint.RecordType
+	for i, r := range rs {
+		p.createRecord(ctx, zones, e, e.Targets[i], r, ptr, result)
+	}
+}
 
-		switch record.Type {
-		case "A":
-			record.RData.IPAddress = &target
-		case "AAAA":
-			record.RData.IPAddress = &target
-		case "CNAME":
-			record.RData.CNAME = &target
-		case "TXT":
-			record.RData.Text = &target
+// createRecord creates the record r of the target of e, along with its PTR
+// record when enabled. A disabled record hidden from Records is enabled in
+// place instead.
+func (p *Provider) createRecord(ctx context.Context, zones zoneIndex, e *endpoint.Endpoint, target string, r sdk.Record, ptr ptrOptions, result *changeBatch) {
+	if result.stopped() {
+		return
+	}
+	if hidden, ok := p.findHidden(r); ok {
+		p.enableRecord(ctx, e, target, hidden, r, result)
+		return
+	}
+	if err := p.client.CreateRecord(ctx, recordRequest(r, ptr)); err != nil {
+		result.add(fmt.Errorf("create %s %s %s: %w", e.DNSName, e.RecordType, target, err))
+		return
+	}
+	result.add(nil)
+	p.cacheChange(ptr, func(c *recordCache) { c.add(r) })
+	result.journal.record(fmt.Sprintf("create %s %s %s", e.DNSName, e.RecordType, target), func(ctx context.Context) error {
+		if err := p.client.DeleteRecord(ctx, &r); err != nil {
+			return err
+		}
+		if ptr.enabled {
+			return p.deletePTR(ctx, zones, r)
 		}
+		return nil
+	})
+}
 
-		ttl := int(endpoint.RecordTTL)
-		if ttl != 0 {
-			record.TTL = ttl
+// enableRecord enables the hidden disabled record hidden matching r, with the
+// TTL and comments of r. Its PTR record is left to the next sync, which
+// reports the PTR state of the enabled record.
+func (p *Provider) enableRecord(ctx context.Context, e *endpoint.Endpoint, target string, hidden, r sdk.Record, result *changeBatch) {
+	enabled := hidden
+	enabled.Disabled = false
+	enabled.TTL = r.TTL
+	enabled.Comments = r.Comments
+	if err := p.client.EnableRecord(ctx, &enabled); err != nil {
+		result.add(fmt.Errorf("enable %s %s %s: %w", e.DNSName, e.RecordType, target, err))
+		return
+	}
+	result.add(nil)
+	p.cacheChange(ptrOptions{}, func(c *recordCache) { c.replace(hidden, enabled) })
+	result.journal.record(fmt.Sprintf("enable %s %s %s", e.DNSName, e.RecordType, target), func(ctx context.Context) error {
+		return p.client.UpdateRecord(ctx, &enabled, recordRequest(hidden, ptrOptions{}))
+	})
+}
+
+// findHidden returns the disabled record hidden from the last Records call
+// that r would create again.
+func (p *Provider) findHidden(r sdk.Record) (sdk.Record, bool) {
+	p.reportedMu.Lock()
+	defer p.reportedMu.Unlock()
+	for _, hidden := range p.hidden {
+		if sameRecord(hidden, r) {
+			return hidden, true
 		}
+	}
+	return sdk.Record{}, false
+}
 
-		records = append(records, *record)
+// updateRecord replaces the record old of e with r in place. A PTR record
+// switched on is created by the update, one switched off is deleted after
+// it, as the update leaves existing PTR records alone.
+func (p *Provider) updateRecord(ctx context.Context, zones zoneIndex, e *endpoint.Endpoint, target string, old, r sdk.Record, oldPTR, ptr ptrOptions, result *changeBatch) {
+	if result.stopped() {
+		return
 	}
+	if err := p.client.UpdateRecord(ctx, &old, recordRequest(r, ptr)); err != nil {
+		result.add(fmt.Errorf("update %s %s %s: %w", e.DNSName, e.RecordType, target, err))
+		return
+	}
+	result.add(nil)
+	p.cacheChange(ptrOptions{enabled: oldPTR.enabled || ptr.enabled}, func(c *recordCache) { c.replace(old, r) })
+	original := result.snapshot.find(old)
+	result.journal.record(fmt.Sprintf("update %s %s %s", e.DNSName, e.RecordType, target), func(ctx context.Context) error {
+		if err := p.client.UpdateRecord(ctx, &r, recordRequest(original, oldPTR)); err != nil {
+			return err
+		}
+		if ptr.enabled && !oldPTR.enabled {
+			return p.deletePTR(ctx, zones, r)
+		}
+		return nil
+	})
 
-	return records
+	if oldPTR.enabled && !ptr.enabled {
+		if err := p.deletePTR(ctx, zones, old); err != nil {
+			result.add(fmt.Errorf("delete PTR of %s %s %s: %w", e.DNSName, e.RecordType, target, err))
+			return
+		}
+		result.add(nil)
+	}
 }
 
-// recordToEndpoint converts a record to an endpoint.
-func recordToEndpoint(r sdk.Record) *endpoint.Endpoint {
-	switch r.Type {
-	case "A":
-		return endpoint.NewEndpointWithTTL(r.Name, r.Type, endpoint.TTL(r.TTL), *r.RData.IPAddress)
-	case "AAAA":
-		return endpoint.NewEndpointWithTTL(r.Name, r.Type, endpoint.TTL(r.TTL), *r.RData.IPAddress)
-	case "CNAME":
-		return endpoint.NewEndpointWithTTL(r.Name, r.Type, endpoint.TTL(r.TTL), *r.RData.CNAME)
-	case "TXT":
-		return endpoint.NewEndpointWithTTL(r.Name, r.Type, endpoint.TTL(r.TTL), *r.RData.Text)
+// getRecords lists the records of the managed zones, from the cache when
+// enabled.
+func (p *Provider) getRecords(ctx context.Context) ([]sdk.Record, error) {
+	if p.cache == nil {
+		return p.client.GetRecords(ctx)
+	}
+	return p.cache.get(ctx, p.client)
+}
+
+// cacheChange mirrors an applied record change in the cache. Changes writing
+// PTR records also touch reverse zones, possibly creating them, so they drop
+// the cache instead.
+func (p *Provider) cacheChange(ptr ptrOptions, change func(c *recordCache)) {
+	switch {
+	case p.cache == nil:
+	case ptr.enabled:
+		p.cache.invalidate()
+	default:
+		change(p.cache)
+	}
+}
+
+// recordRequest builds the request writing r, managing its PTR record when
+// enabled.
+func recordRequest(r sdk.Record, ptr ptrOptions) *sdk.RecordRequest {
+	req := recordToRequest(r)
+	if ptr.enabled {
+		req.PTR = &ptr.enabled
+		req.CreatePTRZone = &ptr.createZone
+	}
+	return req
+}
+
+// updateEndpoint changes old into e target by target. A single target is
+// replaced in place, otherwise only the added targets are created and the
+// removed ones deleted, while kept targets are updated in place when their
+// options or PTR management changed.
+func (p *Provider) updateEndpoint(ctx context.Context, zones zoneIndex, old, e *endpoint.Endpoint, result *changeBatch) {
+	for _, apex := range []*endpoint.Endpoint{old, e} {
+		if err := checkApexNS(zones, apex, "update"); err != nil {
+			result.add(err)
+			return
+		}
+	}
+	oldRs, oldPTR, oldErr := p.endpointRecords(zones, old)
+	rs, ptr, err := p.endpointRecords(zones, e)
+	if err != nil {
+		result.add(fmt.Errorf("update %s %s: %w", e.DNSName, e.RecordType, err))
+		return
+	}
+	if oldErr != nil || !strings.EqualFold(old.DNSName, e.DNSName) || old.RecordType != e.RecordType ||
+		len(oldRs) == 0 || len(rs) == 0 || oldRs[0].Zone != rs[0].Zone {
+		p.deleteEndpoint(ctx, zones, old, result)
+		p.createEndpoint(ctx, zones, e, result)
+		return
+	}
+	p.applyTTL(rs)
+	if err := p.stampComments(e, rs); err != nil {
+		result.add(fmt.Errorf("update %s %s: %w", e.DNSName, e.RecordType, err))
+		return
+	}
+
+	if len(oldRs) == 1 && len(rs) == 1 {
+		// replacing the target drops the old one
+		if targetKey(old.RecordType, old.Targets[0]) != targetKey(e.RecordType, e.Targets[0]) {
+			if err := p.checkMarked(old); err != nil {
+				result.add(fmt.Errorf("update %s %s %s: %w", e.DNSName, e.RecordType, e.Targets[0], err))
+				return
+			}
+		}
+		p.updateRecord(ctx, zones, e, e.Targets[0], oldRs[0], rs[0], oldPTR, ptr, result)
+		return
+	}
+
+	kept := make(map[string]int, len(oldRs))
+	for i, target := range old.Targets {
+		kept[targetKey(old.RecordType, target)] = i
+	}
+
+	// added targets are created before the removed ones are deleted so the
+	// name keeps resolving
+	for i, target := range e.Targets {
+		key := targetKey(e.RecordType, target)
+		j, ok := kept[key]
+		if !ok {
+			p.createRecord(ctx, zones, e, target, rs[i], ptr, result)
+			continue
+		}
+		delete(kept, key)
+		if recordChanged(oldRs[j], rs[i]) || oldPTR.enabled != ptr.enabled {
+			p.updateRecord(ctx, zones, e, target, oldRs[j], rs[i], oldPTR, ptr, result)
+		}
+	}
+
+	for i, target := range old.Targets {
+		if _, ok := kept[targetKey(old.RecordType, target)]; !ok {
+			continue
+		}
+		if err := p.checkMarked(old); err != nil {
+			result.add(fmt.Errorf("delete %s %s %s: %w", old.DNSName, old.RecordType, target, err))
+			continue
+		}
+		p.deleteRecord(ctx, zones, old, target, oldRs[i], oldPTR, result)
+	}
+}
+
+// endpointRecords converts e to records placed in their zone and reports
+// how their PTR records are managed. The zone property overrides the most
+// specific zone of the name.
+func (p *Provider) endpointRecords(zones zoneIndex, e *endpoint.Endpoint) ([]sdk.Record, ptrOptions, error) {
+	zone, err := endpointZone(zones, e)
+	if err != nil {
+		return nil, ptrOptions{}, err
+	}
+
+	rs, err := endpointToRecords(e)
+	if err != nil {
+		return nil, ptrOptions{}, err
+	}
+	for i := range rs {
+		rs[i].Zone = zone
+	}
+
+	ptr, err := p.endpointPTR(e)
+	if err != nil {
+		return nil, ptrOptions{}, err
+	}
+
+	return rs, ptr, nil
+}
+
+// applyTTL sets the TTL of records about to be written following the TTL
+// policy.
+func (p *Provider) applyTTL(rs []sdk.Record) {
+	for i := range rs {
+		rs[i].TTL = p.ttl.apply(rs[i].Name, rs[i].TTL)
+	}
+}
+
+// deletePTR deletes the reverse PTR record of the A or AAAA record r.
+func (p *Provider) deletePTR(ctx context.Context, zones zoneIndex, r sdk.Record) error {
+	ptr, err := ptrRecord(r)
+	if err != nil {
+		return err
+	}
+	// let Technitium find the reverse zone when it is not one we know of
+	ptr.Zone, _ = zones.find(ptr.Name)
+	return p.client.DeleteRecord(ctx, &ptr)
+}
+
+// zoneIndex fetches the zones and indexes them for record placement.
+func (p *Provider) zoneIndex(ctx context.Context) (zoneIndex, error) {
+	zones, err := p.client.GetZones(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch zones: %w", err)
+	}
+	return newZoneIndex(zones), nil
+}
+
+// changeBatch collects the outcome of the record changes of a batch.
+type changeBatch struct {
+	total int
+	errs  []error
+
+	// journal and snapshot are only set for transactional batches
+	journal  *journal
+	snapshot snapshot
+}
+
+// add records the outcome of one record change.
+func (c *changeBatch) add(err error) {
+	c.total++
+	if err != nil {
+		c.errs = append(c.errs, err)
+	}
+}
+
+// stopped reports whether a transactional batch already failed, in which case
+// the remaining changes are skipped.
+func (c *changeBatch) stopped() bool {
+	return c.journal != nil && len(c.errs) > 0
+}
+
+// err aggregates the failed changes, if any.
+func (c *changeBatch) err() error {
+	if len(c.errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d record changes failed: %w", len(c.errs), c.total, errors.Join(c.errs...))
+}
+
+// recordChanged reports whether writing r changes the existing record old
+// with the same data. Comments are compared without their marker line.
+func recordChanged(old, r sdk.Record) bool {
+	return old.TTL != r.TTL || !slices.Equal(old.RData.Glue, r.RData.Glue) ||
+		userComment(old.Comments) != userComment(r.Comments) ||
+		old.ExpiryTTL != r.ExpiryTTL || old.Disabled != r.Disabled
+}
+
+// checkApexNS refuses changes to the name servers of a zone, which are not
+// reported by Records and so never managed.
+func checkApexNS(zones zoneIndex, e *endpoint.Endpoint, action string) error {
+	if e.RecordType == "NS" && zones.isApex(e.DNSName) {
+		return fmt.Errorf("%s %s %s: refusing to %s the name servers of zone %s", action, e.DNSName, e.RecordType, action, e.DNSName)
 	}
 	return nil
 }
 
+// isApexNS reports whether r is one of the name servers of its own zone.
+func isApexNS(r sdk.Record) bool {
+	return r.Type == "NS" && r.Zone != "" && strings.EqualFold(r.Name, r.Zone)
+}
+
 // sameEndpoints returns if the two endpoints have the same values.
 func sameEndpoints(a endpoint.Endpoint, b endpoint.Endpoint) bool {
-	result := (a.DNSName == b.DNSName && a.RecordType == b.RecordType && a.RecordTTL == b.RecordTTL && a.Targets.Same(b.Targets))
+	result := (a.DNSName == b.DNSName && a.RecordType == b.RecordType && a.RecordTTL == b.RecordTTL && a.Targets.Same(b.Targets) && sameProperties(&a, &b))
 	if !result {
 		log.Warnf("Endpoints do not match: %v, %v", a, b)
 	}
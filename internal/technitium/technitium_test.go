@@ -1,19 +1,32 @@
 package technitium
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"sigs.k8s.io/external-dns/endpoint"
 	"sigs.k8s.io/external-dns/plan"
 
 	sdk "github.com/chrisatcho/external-dns-technitiumdns-webhook/pkg/sdk"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 )
 
 type mockDnsService struct {
 	testErrorReturned bool
+	// failChanges fails record changes only
+	failChanges bool
+	// failName fails the record changes of a single name
+	failName string
 }
 
 func TestNewProvider(t *testing.T) {
@@ -24,29 +37,407 @@ func TestNewProvider(t *testing.T) {
 	require.NotNilf(t, p.client, "client should not be nil")
 }
 
+func TestConfigurationValidate(t *testing.T) {
+	require.NoError(t, (&Configuration{User: "admin", Pass: "admin"}).Validate())
+	require.NoError(t, (&Configuration{Token: "token"}).Validate())
+	require.Error(t, (&Configuration{}).Validate())
+	require.Error(t, (&Configuration{User: "admin"}).Validate())
+	require.Error(t, (&Configuration{User: "admin", Pass: "admin", Token: "token"}).Validate())
+	require.Error(t, (&Configuration{Token: "token", MinTTL: 600, MaxTTL: 300}).Validate())
+	require.Error(t, (&Configuration{Token: "token", DefaultTTL: -1}).Validate())
+	require.Error(t, (&Configuration{Token: "token", ZoneTTLs: map[string]int{"a.au": 0}}).Validate())
+	require.Error(t, (&Configuration{Token: "token", Comments: true, CommentTemplate: "{{.Owner"}).Validate())
+	require.Error(t, (&Configuration{Token: "token", ProtectUnmarked: true}).Validate())
+	require.Error(t, (&Configuration{Token: "token", DisabledRecords: "ignore"}).Validate())
+	require.NoError(t, (&Configuration{Token: "token", ZoneTypes: []string{"primary", "Forwarder"}}).Validate())
+	require.Error(t, (&Configuration{Token: "token", ZoneTypes: []string{"Primary", "Master"}}).Validate())
+	require.Error(t, (&Configuration{Token: "token", ExcludeZoneTypes: []string{"Slave"}}).Validate())
+	require.Error(t, (&Configuration{Token: "token", ListConcurrency: -1}).Validate())
+	require.Error(t, (&Configuration{Token: "token", CacheTTL: -time.Second}).Validate())
+	require.Error(t, (&Configuration{Token: "token", ZonesPerPage: -1}).Validate())
+	require.Error(t, (&Configuration{Token: "token", RetryAttempts: -1}).Validate())
+}
+
+func TestTTLPolicy(t *testing.T) {
+	policy := newTTLPolicy(&Configuration{
+		DefaultTTL: 600,
+		MinTTL:     60,
+		MaxTTL:     86400,
+		ZoneTTLs:   map[string]int{"k8s.a.au.": 30, "b.au": 7200},
+	})
+	require.Equal(t, 600, policy.apply("www.a.au", 0))
+	require.Equal(t, 7200, policy.apply("www.b.au", 0))
+	// zone defaults are clamped too
+	require.Equal(t, 60, policy.apply("app.k8s.a.au", 0))
+	require.Equal(t, 60, policy.apply("www.a.au", 10))
+	require.Equal(t, 86400, policy.apply("www.a.au", 604800))
+	require.Equal(t, 300, policy.apply("www.a.au", 300))
+
+	// an unconfigured policy falls back to the Technitium default
+	require.Equal(t, defaultTTL, ttlPolicy{}.apply("www.a.au", 0))
+
+	provider := &Provider{client: mockDnsService{}, ttl: policy}
+	err := provider.ApplyChanges(context.Background(), &plan.Changes{
+		Create:    []*endpoint.Endpoint{endpoint.NewEndpoint("ttl.b.au", "A", "10.0.0.1")},
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("ttl.a.au", "A", 600, "10.0.0.2")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("ttl.a.au", "A", 5, "10.0.0.3")},
+	})
+	require.NoError(t, err)
+	require.True(t, isRecordCreated("ttl.b.au", "A", "10.0.0.1", 7200))
+	require.Equal(t, 60, *updatedRecords[len(updatedRecords)-1].new.TTL)
+
+	endpoints, err := provider.AdjustEndpoints([]*endpoint.Endpoint{endpoint.NewEndpoint("ttl.b.au", "A", "10.0.0.1")})
+	require.NoError(t, err)
+	require.Equal(t, endpoint.TTL(7200), endpoints[0].RecordTTL)
+}
+
 func TestRecords(t *testing.T) {
 	log.SetLevel(log.DebugLevel)
 
 	provider := &Provider{client: mockDnsService{testErrorReturned: false}}
-	endpoints, err := provider.Records(nil)
+	endpoints, err := provider.Records(context.Background())
 	if err != nil {
 		t.Errorf("should not fail, %s", err)
 	}
 	for _, e := range endpoints {
 		log.Info(e)
 	}
+	// the apex NS record is hidden and the A records of a.au are merged
 	require.Equal(t, 3, len(endpoints))
+	require.Equal(t, endpoint.Targets{"1.1.1.1", "1.1.1.2"}, endpoints[0].Targets)
+	glue, _ := endpoints[2].GetProviderSpecificProperty(providerSpecificGlue)
+	require.Equal(t, "ns1.team.a.au=10.0.0.1", glue)
+	ptr, _ := endpoints[0].GetProviderSpecificProperty(providerSpecificPTR)
+	require.Equal(t, "true", ptr)
+	_, ok := endpoints[1].GetProviderSpecificProperty(providerSpecificPTR)
+	require.False(t, ok)
+
+	// with PTR management enabled the missing PTR records are reported instead
+	provider = &Provider{client: mockDnsService{testErrorReturned: false}, createPTR: true}
+	endpoints, err = provider.Records(context.Background())
+	require.NoError(t, err)
+	_, ok = endpoints[0].GetProviderSpecificProperty(providerSpecificPTR)
+	require.False(t, ok)
+	ptr, _ = endpoints[1].GetProviderSpecificProperty(providerSpecificPTR)
+	require.Equal(t, "false", ptr)
 
 	provider = &Provider{client: mockDnsService{testErrorReturned: true}}
-	endpoints, err = provider.Records(nil)
+	endpoints, err = provider.Records(context.Background())
+	require.Error(t, err)
 	require.Equal(t, 0, len(endpoints))
 }
 
+func TestRecordsRoundTrip(t *testing.T) {
+	for _, createPTR := range []bool{false, true} {
+		for _, preservePTR := range []bool{false, true} {
+			provider := &Provider{client: mockDnsService{}, createPTR: createPTR, preservePTR: preservePTR}
+			current, err := provider.Records(context.Background())
+			require.NoError(t, err)
+
+			// the sources only know the targets and the annotated glue
+			var desired []*endpoint.Endpoint
+			for _, e := range current {
+				d := endpoint.NewEndpointWithTTL(e.DNSName, e.RecordType, e.RecordTTL, e.Targets...)
+				if glue, ok := e.GetProviderSpecificProperty(providerSpecificGlue); ok {
+					d.SetProviderSpecificProperty(providerSpecificGlue, glue)
+				}
+				desired = append(desired, d)
+			}
+
+			changes := syncPlan(t, provider, desired)
+			if preservePTR {
+				require.False(t, changes.HasChanges(), "createPTR=%v: %+v", createPTR, changes)
+				continue
+			}
+
+			// the records whose PTR state differs from the setting are
+			// updated in place
+			require.Empty(t, changes.Create, "createPTR=%v", createPTR)
+			require.Empty(t, changes.Delete, "createPTR=%v", createPTR)
+			require.NotEmpty(t, changes.UpdateNew, "createPTR=%v", createPTR)
+			for _, e := range changes.UpdateNew {
+				require.Contains(t, []string{"A", "AAAA"}, e.RecordType)
+			}
+		}
+	}
+}
+
+func TestPTRState(t *testing.T) {
+	ip, ptrName := "10.0.0.5", "web.a.au"
+	web := sdk.Record{Zone: "a.au", Name: "web.a.au", Type: "A", TTL: 300, RData: sdk.RData{IPAddress: &ip}}
+	ptr := sdk.Record{Zone: "10.in-addr.arpa", Name: "5.0.0.10.in-addr.arpa", Type: "PTR", TTL: 300, RData: sdk.RData{PTRName: &ptrName}}
+	desired := func(properties ...string) []*endpoint.Endpoint {
+		e := endpoint.NewEndpointWithTTL("web.a.au", "A", 300, "10.0.0.5")
+		for _, value := range properties {
+			e.SetProviderSpecificProperty(providerSpecificPTR, value)
+		}
+		return []*endpoint.Endpoint{e}
+	}
+	reset := func() {
+		createdRecords, deletedRecords, updatedRecords = nil, nil, nil
+	}
+
+	// a PTR record added by hand is removed in place with PTR management off
+	provider := &Provider{client: disabledRecordsService{records: []sdk.Record{web, ptr}}}
+	for _, properties := range [][]string{nil, {"false"}} {
+		reset()
+		changes := syncPlan(t, provider, desired(properties...))
+		require.Len(t, changes.UpdateNew, 1)
+		require.Empty(t, changes.Create)
+		require.Empty(t, changes.Delete)
+		require.NoError(t, provider.ApplyChanges(context.Background(), changes))
+		require.Empty(t, createdRecords)
+		require.Len(t, updatedRecords, 1)
+		require.Nil(t, updatedRecords[0].new.PTR)
+		require.Len(t, deletedRecords, 1)
+		require.Equal(t, "PTR", deletedRecords[0].Type)
+		require.Equal(t, "5.0.0.10.in-addr.arpa", deletedRecords[0].Name)
+	}
+
+	// unless the endpoint keeps it
+	require.False(t, syncPlan(t, provider, desired("true")).HasChanges())
+
+	// or the PTR state is preserved
+	provider.preservePTR = true
+	require.False(t, syncPlan(t, provider, desired()).HasChanges())
+
+	// a PTR record removed by hand is added back in place with PTR management
+	// on
+	provider = &Provider{client: disabledRecordsService{records: []sdk.Record{web}}, createPTR: true}
+	for _, properties := range [][]string{nil, {"true"}} {
+		reset()
+		changes := syncPlan(t, provider, desired(properties...))
+		require.Len(t, changes.UpdateNew, 1)
+		require.Empty(t, changes.Create)
+		require.Empty(t, changes.Delete)
+		require.NoError(t, provider.ApplyChanges(context.Background(), changes))
+		require.Empty(t, createdRecords)
+		require.Empty(t, deletedRecords)
+		require.Len(t, updatedRecords, 1)
+		require.True(t, *updatedRecords[0].new.PTR)
+		require.True(t, *updatedRecords[0].new.CreatePTRZone)
+	}
+
+	// unless the endpoint leaves it out
+	require.False(t, syncPlan(t, provider, desired("false")).HasChanges())
+
+	// or the PTR state is preserved
+	provider.preservePTR = true
+	require.False(t, syncPlan(t, provider, desired()).HasChanges())
+}
+
+// syncPlan plans desired against the records of p the way ExternalDNS does.
+func syncPlan(t *testing.T, p *Provider, desired []*endpoint.Endpoint) *plan.Changes {
+	t.Helper()
+	current, err := p.Records(context.Background())
+	require.NoError(t, err)
+	desired, err = p.AdjustEndpoints(desired)
+	require.NoError(t, err)
+
+	return (&plan.Plan{
+		Current:        current,
+		Desired:        desired,
+		Policies:       []plan.Policy{&plan.SyncPolicy{}},
+		ManagedRecords: []string{"A", "AAAA", "CNAME", "TXT", "NS", "MX", "SRV", "CAA"},
+	}).Calculate().Changes
+}
+
+func TestGetRecordsBestEffort(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/user/login", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"token": "token", "status": "ok"}`)
+	})
+	mux.HandleFunc("GET /api/zones/list", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"response": {"zones": [{"name": "a.au"}, {"name": "b.au"}]}, "status": "ok"}`)
+	})
+	mux.HandleFunc("GET /api/zones/records/get", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("domain") == "a.au" {
+			fmt.Fprint(w, `{"status": "error", "errorMessage": "zone is broken"}`)
+			return
+		}
+		fmt.Fprint(w, `{"response": {"records": [{"name": "b.au", "type": "A", "ttl": 3600, "rData": {"ipAddress": "2.2.2.2"}}]}, "status": "ok"}`)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client := sdk.NewAPIClient(&sdk.Configuration{BaseURL: server.URL, User: "admin", Pass: "admin"})
+
+	// strict mode fails the whole listing
+	_, err := DnsClient{client: client}.GetRecords(context.Background())
+	require.ErrorContains(t, err, "zone a.au")
+
+	records, err := DnsClient{client: client, bestEffort: true}.GetRecords(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, len(records))
+	require.Equal(t, "b.au", records[0].Name)
+	require.Equal(t, 1.0, testutil.ToFloat64(skippedZones.WithLabelValues("a.au")))
+}
+
+func TestZoneFilter(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/user/login", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"token": "token", "status": "ok"}`)
+	})
+	mux.HandleFunc("GET /api/zones/list", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"response": {"zones": [
+			{"name": "a.au", "type": "Primary"},
+			{"name": "b.au", "type": "Secondary"},
+			{"name": "c.au", "type": "Stub"},
+			{"name": "d.au", "type": "Forwarder"},
+			{"name": "localhost", "type": "Primary", "internal": true},
+			{"name": "e.au", "type": "Primary", "disabled": true},
+			{"name": "f.au", "type": "Forwarder", "isExpired": true}
+		]}, "status": "ok"}`)
+	})
+	mux.HandleFunc("GET /api/zones/records/get", func(w http.ResponseWriter, r *http.Request) {
+		domain := r.URL.Query().Get("domain")
+		fmt.Fprintf(w, `{"response": {"records": [{"name": "%s", "type": "A", "ttl": 3600, "rData": {"ipAddress": "2.2.2.2"}}]}, "status": "ok"}`, domain)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client := sdk.NewAPIClient(&sdk.Configuration{BaseURL: server.URL, User: "admin", Pass: "admin"})
+	names := func(c DnsClient) []string {
+		zones, err := c.GetZones(context.Background())
+		require.NoError(t, err)
+		records, err := c.GetRecords(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, len(zones), len(records))
+		var names []string
+		for _, zone := range zones {
+			names = append(names, zone.Name)
+		}
+		return names
+	}
+
+	require.Equal(t, []string{"a.au", "d.au"}, names(DnsClient{client: client, zones: newZoneFilter([]string{"Primary", "Forwarder"}, nil)}))
+	require.Equal(t, []string{"a.au", "b.au", "c.au"}, names(DnsClient{client: client, zones: newZoneFilter(nil, []string{"forwarder"})}))
+	require.Equal(t, []string{"a.au"}, names(DnsClient{client: client, zones: newZoneFilter([]string{"Primary", "Forwarder"}, []string{"Forwarder"})}))
+}
+
+func TestGetRecordsConcurrency(t *testing.T) {
+	var inFlight, maxInFlight, listed atomic.Int32
+	var failFirst atomic.Bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/user/login", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"token": "token", "status": "ok"}`)
+	})
+	mux.HandleFunc("GET /api/zones/list", func(w http.ResponseWriter, r *http.Request) {
+		var zones []string
+		for i := range 20 {
+			zones = append(zones, fmt.Sprintf(`{"name": "z%02d.au"}`, i))
+		}
+		fmt.Fprintf(w, `{"response": {"zones": [%s]}, "status": "ok"}`, strings.Join(zones, ","))
+	})
+	mux.HandleFunc("GET /api/zones/records/get", func(w http.ResponseWriter, r *http.Request) {
+		listed.Add(1)
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		domain := r.URL.Query().Get("domain")
+		if domain == "z00.au" && failFirst.Load() {
+			fmt.Fprint(w, `{"status": "error", "errorMessage": "zone is broken"}`)
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+		fmt.Fprintf(w, `{"response": {"records": [{"name": "%s", "type": "A", "ttl": 3600, "rData": {"ipAddress": "2.2.2.2"}}]}, "status": "ok"}`, domain)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client := sdk.NewAPIClient(&sdk.Configuration{BaseURL: server.URL, User: "admin", Pass: "admin"})
+	records, err := DnsClient{client: client, concurrency: 4}.GetRecords(context.Background())
+	require.NoError(t, err)
+	require.Len(t, records, 20)
+	for i, r := range records {
+		require.Equal(t, fmt.Sprintf("z%02d.au", i), r.Name)
+	}
+	require.LessOrEqual(t, maxInFlight.Load(), int32(4))
+	require.Equal(t, int32(20), listed.Load())
+
+	// the first error aborts the remaining zones
+	failFirst.Store(true)
+	listed.Store(0)
+	_, err = DnsClient{client: client, concurrency: 1}.GetRecords(context.Background())
+	require.ErrorContains(t, err, "zone z00.au")
+	require.Equal(t, int32(1), listed.Load())
+
+	// a cancelled listing is aborted
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = DnsClient{client: client, concurrency: 4, bestEffort: true}.GetRecords(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestGetRecordsIncremental(t *testing.T) {
+	var mu sync.Mutex
+	serials := map[string]string{"a.au": `"soaSerial": 1`, "b.au": `"soaSerial": 1`, "c.au": `"lastModified": "2026-01-01T00:00:00Z"`, "d.au": ""}
+	listed := map[string]int{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/user/login", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"token": "token", "status": "ok"}`)
+	})
+	mux.HandleFunc("GET /api/zones/list", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var zones []string
+		for _, name := range []string{"a.au", "b.au", "c.au", "d.au"} {
+			if state, ok := serials[name]; ok {
+				zones = append(zones, fmt.Sprintf(`{"name": "%s", "type": "Primary"%s}`, name, strings.TrimSuffix(", "+state, ", ")))
+			}
+		}
+		fmt.Fprintf(w, `{"response": {"zones": [%s]}, "status": "ok"}`, strings.Join(zones, ","))
+	})
+	mux.HandleFunc("GET /api/zones/records/get", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		domain := r.URL.Query().Get("domain")
+		listed[domain]++
+		fmt.Fprintf(w, `{"response": {"records": [{"name": "%s", "type": "A", "ttl": 3600, "rData": {"ipAddress": "2.2.2.%d"}}]}, "status": "ok"}`, domain, listed[domain])
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client := DnsClient{client: sdk.NewAPIClient(&sdk.Configuration{BaseURL: server.URL, User: "admin", Pass: "admin"}), zoneRecords: newZoneRecords()}
+	addresses := func() []string {
+		records, err := client.GetRecords(context.Background())
+		require.NoError(t, err)
+		var addresses []string
+		for _, r := range records {
+			addresses = append(addresses, *r.RData.IPAddress)
+		}
+		return addresses
+	}
+
+	require.Equal(t, []string{"2.2.2.1", "2.2.2.1", "2.2.2.1", "2.2.2.1"}, addresses())
+	// zones of unknown state are always listed again
+	require.Equal(t, []string{"2.2.2.1", "2.2.2.1", "2.2.2.1", "2.2.2.2"}, addresses())
+
+	mu.Lock()
+	serials["b.au"] = `"soaSerial": 2`
+	serials["c.au"] = `"lastModified": "2026-01-02T00:00:00Z"`
+	mu.Unlock()
+	require.Equal(t, []string{"2.2.2.1", "2.2.2.2", "2.2.2.2", "2.2.2.3"}, addresses())
+	require.Equal(t, map[string]int{"a.au": 1, "b.au": 2, "c.au": 2, "d.au": 3}, listed)
+
+	// dropped zones are forgotten
+	mu.Lock()
+	delete(serials, "a.au")
+	mu.Unlock()
+	addresses()
+	require.NotContains(t, client.zoneRecords.zones, "a.au")
+}
+
 func TestApplyChanges(t *testing.T) {
 	log.SetLevel(log.DebugLevel)
 
 	provider := &Provider{client: mockDnsService{testErrorReturned: false}}
-	err := provider.ApplyChanges(nil, changes())
+	err := provider.ApplyChanges(context.Background(), changes())
 	if err != nil {
 		t.Errorf("should not fail, %s", err)
 	}
@@ -66,14 +457,809 @@ func TestApplyChanges(t *testing.T) {
 	}
 
 	provider = &Provider{client: mockDnsService{testErrorReturned: true}}
-	err = provider.ApplyChanges(nil, nil)
+	err = provider.ApplyChanges(context.Background(), nil)
 
 	if err == nil {
 		t.Errorf("expected to fail, %s", err)
 	}
 }
 
-func (m mockDnsService) GetZones() ([]sdk.Zone, error) {
+func TestApplyChangesErrors(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+
+	provider := &Provider{client: mockDnsService{failChanges: true}}
+	err := provider.ApplyChanges(context.Background(), changes())
+	require.Error(t, err)
+
+	// every change is attempted and reported
+	require.Contains(t, err.Error(), "6 of 6 record changes failed")
+	require.Contains(t, err.Error(), "delete b.au A 5.5.5.5: DeleteRecord failed")
+	require.Contains(t, err.Error(), "create new.a.au CNAME a.au: CreateRecord failed")
+}
+
+func TestUpdateInPlace(t *testing.T) {
+	provider := &Provider{client: mockDnsService{}}
+	deletes, creates := len(deletedRecords), len(createdRecords)
+
+	// single target change
+	err := provider.ApplyChanges(context.Background(), &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{{DNSName: "web.a.au", RecordType: "A", Targets: endpoint.Targets{"1.1.1.1"}, RecordTTL: 300}},
+		UpdateNew: []*endpoint.Endpoint{{DNSName: "web.a.au", RecordType: "A", Targets: endpoint.Targets{"2.2.2.2"}, RecordTTL: 600}},
+	})
+	require.NoError(t, err)
+	updated := updatedRecords[len(updatedRecords)-1]
+	require.Equal(t, "1.1.1.1", *updated.old.RData.IPAddress)
+	require.Equal(t, "a.au", updated.old.Zone)
+	require.Equal(t, "2.2.2.2", *updated.new.IPAddress)
+	require.Equal(t, 600, *updated.new.TTL)
+
+	// TTL only change of several targets
+	err = provider.ApplyChanges(context.Background(), &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{{DNSName: "web.a.au", RecordType: "A", Targets: endpoint.Targets{"2.2.2.2", "1.1.1.1"}, RecordTTL: 300}},
+		UpdateNew: []*endpoint.Endpoint{{DNSName: "web.a.au", RecordType: "A", Targets: endpoint.Targets{"1.1.1.1", "2.2.2.2"}, RecordTTL: 600}},
+	})
+	require.NoError(t, err)
+	for _, u := range updatedRecords[len(updatedRecords)-2:] {
+		require.Equal(t, *u.old.RData.IPAddress, *u.new.IPAddress)
+		require.Equal(t, 600, *u.new.TTL)
+	}
+	require.Equal(t, deletes, len(deletedRecords))
+	require.Equal(t, creates, len(createdRecords))
+
+	// other changes are recreated
+	updates := len(updatedRecords)
+	err = provider.ApplyChanges(context.Background(), &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{{DNSName: "web.a.au", RecordType: "A", Targets: endpoint.Targets{"1.1.1.1", "2.2.2.2"}}},
+		UpdateNew: []*endpoint.Endpoint{{DNSName: "web.a.au", RecordType: "A", Targets: endpoint.Targets{"3.3.3.3"}}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, updates, len(updatedRecords))
+	require.Equal(t, deletes+2, len(deletedRecords))
+	require.True(t, isRecordCreated("web.a.au", "A", "3.3.3.3", 0))
+
+	provider = &Provider{client: mockDnsService{failChanges: true}}
+	err = provider.ApplyChanges(context.Background(), &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{{DNSName: "web.a.au", RecordType: "A", Targets: endpoint.Targets{"1.1.1.1"}}},
+		UpdateNew: []*endpoint.Endpoint{{DNSName: "web.a.au", RecordType: "A", Targets: endpoint.Targets{"2.2.2.2"}}},
+	})
+	require.ErrorContains(t, err, "update web.a.au A 2.2.2.2: UpdateRecord failed")
+}
+
+func TestPerTargetDiff(t *testing.T) {
+	provider := &Provider{client: mockDnsService{}}
+	deletes, creates, updates := len(deletedRecords), len(createdRecords), len(updatedRecords)
+
+	err := provider.ApplyChanges(context.Background(), &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{{DNSName: "rr.a.au", RecordType: "A", Targets: endpoint.Targets{"1.1.1.1", "2.2.2.2"}, RecordTTL: 300}},
+		UpdateNew: []*endpoint.Endpoint{{DNSName: "rr.a.au", RecordType: "A", Targets: endpoint.Targets{"1.1.1.1", "3.3.3.3"}, RecordTTL: 300}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, creates+1, len(createdRecords))
+	require.True(t, isRecordCreated("rr.a.au", "A", "3.3.3.3", 300))
+	require.Equal(t, deletes+1, len(deletedRecords))
+	require.Equal(t, "2.2.2.2", *deletedRecords[len(deletedRecords)-1].RData.IPAddress)
+	require.Equal(t, updates, len(updatedRecords))
+
+	// kept targets only change their TTL, IPv6 addresses are compared parsed
+	err = provider.ApplyChanges(context.Background(), &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{{DNSName: "rr.a.au", RecordType: "AAAA", Targets: endpoint.Targets{"2001:db8::1", "2001:db8::2"}, RecordTTL: 300}},
+		UpdateNew: []*endpoint.Endpoint{{DNSName: "rr.a.au", RecordType: "AAAA", Targets: endpoint.Targets{"2001:DB8:0::1", "2001:db8::3"}, RecordTTL: 600}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, creates+2, len(createdRecords))
+	require.Equal(t, deletes+2, len(deletedRecords))
+	require.Equal(t, updates+1, len(updatedRecords))
+	updated := updatedRecords[len(updatedRecords)-1]
+	require.Equal(t, "2001:db8::1", *updated.old.RData.IPAddress)
+	require.Equal(t, 600, *updated.new.TTL)
+}
+
+func TestTransactionalRollback(t *testing.T) {
+	provider := &Provider{client: mockDnsService{failName: "new.a.au"}, transactional: true}
+	deletes, creates, updates := len(deletedRecords), len(createdRecords), len(updatedRecords)
+
+	err := provider.ApplyChanges(context.Background(), &plan.Changes{
+		Delete:    []*endpoint.Endpoint{{DNSName: "b.au", RecordType: "A", Targets: endpoint.Targets{"2.2.2.2"}}},
+		UpdateOld: []*endpoint.Endpoint{{DNSName: "a.au", RecordType: "A", Targets: endpoint.Targets{"1.1.1.1"}}},
+		UpdateNew: []*endpoint.Endpoint{{DNSName: "a.au", RecordType: "A", Targets: endpoint.Targets{"3.3.3.3"}, RecordTTL: 60}},
+		Create: []*endpoint.Endpoint{
+			{DNSName: "new.a.au", RecordType: "CNAME", Targets: endpoint.Targets{"a.au"}},
+			{DNSName: "other.a.au", RecordType: "CNAME", Targets: endpoint.Targets{"a.au"}},
+		},
+	})
+	require.ErrorContains(t, err, "1 of 3 record changes failed")
+	require.ErrorContains(t, err, "create new.a.au CNAME a.au: CreateRecord failed")
+	require.ErrorContains(t, err, "rolled back 2 applied changes")
+
+	// the changes after the failure are skipped
+	require.False(t, isRecordCreated("other.a.au", "CNAME", "a.au", 0))
+
+	// the update is reverted to the snapshot, then the deleted record restored
+	// with its original TTL
+	require.Equal(t, updates+2, len(updatedRecords))
+	reverted := updatedRecords[len(updatedRecords)-1]
+	require.Equal(t, "3.3.3.3", *reverted.old.RData.IPAddress)
+	require.Equal(t, "1.1.1.1", *reverted.new.IPAddress)
+	require.Equal(t, 3000, *reverted.new.TTL)
+	require.Equal(t, deletes+1, len(deletedRecords))
+	require.Equal(t, creates+1, len(createdRecords))
+	require.True(t, isRecordCreated("b.au", "A", "2.2.2.2", 3000))
+
+	// every inverse is attempted and the failed ones reported
+	var undone []string
+	j := &journal{}
+	for _, change := range []string{"first", "second", "third"} {
+		j.record(change, func(ctx context.Context) error {
+			undone = append(undone, change)
+			if change == "second" {
+				return fmt.Errorf("undo failed")
+			}
+			return nil
+		})
+	}
+	err = j.rollback(context.Background())
+	require.EqualError(t, err, "rollback failed for 1 of 3 changes: undo second: undo failed")
+	require.Equal(t, []string{"third", "second", "first"}, undone)
+}
+
+func TestSnapshotZoneProperty(t *testing.T) {
+	provider := &Provider{client: parentZoneService{}}
+	zones := newZoneIndex([]sdk.Zone{{Name: "a.au"}, {Name: "sub.a.au"}})
+	e := endpoint.NewEndpointWithTTL("x.sub.a.au", "A", 60, "10.0.0.9").WithProviderSpecific(providerSpecificZone, "a.au")
+
+	s, err := provider.takeSnapshot(context.Background(), zones, []*endpoint.Endpoint{e})
+	require.NoError(t, err)
+	rs, _, err := provider.endpointRecords(zones, e)
+	require.NoError(t, err)
+
+	// the record is restored from the zone it is placed in
+	original := s.find(rs[0])
+	require.Equal(t, "a.au", original.Zone)
+	require.Equal(t, 900, original.TTL)
+	require.Equal(t, "hand made", original.Comments)
+}
+
+// parentZoneService serves x.sub.a.au from the a.au zone, although sub.a.au
+// is hosted as well.
+type parentZoneService struct {
+	mockDnsService
+}
+
+func (m parentZoneService) GetDomainRecords(ctx context.Context, zone, domain string) ([]sdk.Record, error) {
+	if zone != "a.au" || domain != "x.sub.a.au" {
+		return nil, nil
+	}
+	ip := "10.0.0.9"
+	return []sdk.Record{{Zone: "a.au", Name: "x.sub.a.au", Type: "A", TTL: 900, Comments: "hand made", RData: sdk.RData{IPAddress: &ip}}}, nil
+}
+
+func TestAdjustEndpoints(t *testing.T) {
+	provider := &Provider{}
+	endpoints, err := provider.AdjustEndpoints([]*endpoint.Endpoint{
+		{DNSName: "WWW.a.au.", RecordType: "CNAME", Targets: endpoint.Targets{"a.au."}},
+		{DNSName: "v6.a.au", RecordType: "AAAA", Targets: endpoint.Targets{"2001:DB8:0::1"}, RecordTTL: 60},
+		{DNSName: "a.au", RecordType: "MX", Targets: endpoint.Targets{"010 mail.a.au."}},
+		{DNSName: "_sip._tcp.a.au", RecordType: "SRV", Targets: endpoint.Targets{"10 05 5060 sip.a.au."}},
+		{DNSName: "a.au", RecordType: "CAA", Targets: endpoint.Targets{"0 issue letsencrypt.org"}},
+		{DNSName: "bad.a.au", RecordType: "A", Targets: endpoint.Targets{"not an address"}},
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, "www.a.au", endpoints[0].DNSName)
+	require.Equal(t, endpoint.Targets{"a.au"}, endpoints[0].Targets)
+	require.Equal(t, endpoint.TTL(defaultTTL), endpoints[0].RecordTTL)
+	require.Equal(t, endpoint.Targets{"2001:db8::1"}, endpoints[1].Targets)
+	require.Equal(t, endpoint.TTL(60), endpoints[1].RecordTTL)
+	require.Equal(t, endpoint.Targets{"10 mail.a.au"}, endpoints[2].Targets)
+	require.Equal(t, endpoint.Targets{"10 5 5060 sip.a.au"}, endpoints[3].Targets)
+	require.Equal(t, endpoint.Targets{`0 issue "letsencrypt.org"`}, endpoints[4].Targets)
+	require.Equal(t, endpoint.Targets{"not an address"}, endpoints[5].Targets)
+}
+
+func TestLongTXTRecords(t *testing.T) {
+	text := strings.Repeat("a", 254) + "é" + strings.Repeat("b", 300)
+	req := recordToRequest(sdk.Record{Name: "txt.a.au", Type: "TXT", RData: sdk.RData{Text: &text}})
+	require.True(t, *req.SplitText)
+	parts := strings.Split(*req.Text, "\n")
+	require.Len(t, parts, 3)
+	require.Equal(t, strings.Repeat("a", 254), parts[0])
+	for _, part := range parts {
+		require.LessOrEqual(t, len(part), maxTXTString)
+	}
+
+	// the split text reads back as the original target
+	e := recordToEndpoint(sdk.Record{Name: "txt.a.au", Type: "TXT", RData: sdk.RData{Text: req.Text, SplitText: req.SplitText}})
+	require.Equal(t, endpoint.Targets{text}, e.Targets)
+
+	short := "heritage=external-dns"
+	req = recordToRequest(sdk.Record{Name: "txt.a.au", Type: "TXT", RData: sdk.RData{Text: &short}})
+	require.Nil(t, req.SplitText)
+	require.Equal(t, short, *req.Text)
+}
+
+func TestComments(t *testing.T) {
+	comments, err := parseCommentTemplate("owner={{.OwnerID}} resource={{.Resource}}")
+	require.NoError(t, err)
+	provider := &Provider{client: mockDnsService{}, comments: comments}
+
+	e := endpoint.NewEndpoint("owned.a.au", "A", "10.0.0.1")
+	e.Labels[endpoint.OwnerLabelKey] = "default"
+	e.Labels[endpoint.ResourceLabelKey] = "ingress/default/app"
+	err = provider.ApplyChanges(context.Background(), &plan.Changes{Create: []*endpoint.Endpoint{e}})
+	require.NoError(t, err)
+	require.Equal(t, "[external-dns] owner=default resource=ingress/default/app", *createdRecords[len(createdRecords)-1].Comments)
+
+	// the default template stamps the time of the change
+	comments, err = parseCommentTemplate("")
+	require.NoError(t, err)
+	provider.comments = comments
+	rs := []sdk.Record{{Name: "owned.a.au"}}
+	require.NoError(t, provider.stampComments(endpoint.NewEndpoint("owned.a.au", "A", "10.0.0.1"), rs))
+	require.Regexp(t, `^\[external-dns\] updated=\d{4}-\d{2}-\d{2}T`, rs[0].Comments)
+
+	// comments are reported, a merged endpoint is only marked when all its
+	// records are
+	marked := recordToEndpoint(sdk.Record{Name: "a.au", Type: "A", RData: sdk.RData{IPAddress: &[]string{"1.1.1.1"}[0]}, Comments: "[external-dns] owner=default"})
+	unmarked := recordToEndpoint(sdk.Record{Name: "a.au", Type: "A", RData: sdk.RData{IPAddress: &[]string{"1.1.1.2"}[0]}})
+	comment, _ := marked.GetProviderSpecificProperty(providerSpecificComments)
+	require.Equal(t, "[external-dns] owner=default", comment)
+	mergeEndpoint(marked, unmarked)
+	_, ok := marked.GetProviderSpecificProperty(providerSpecificComments)
+	require.False(t, ok)
+
+	// unmarked records are protected from deletion
+	provider = &Provider{client: mockDnsService{}, protectUnmarked: true}
+	deletes := len(deletedRecords)
+	owned := endpoint.NewEndpoint("owned.a.au", "A", "10.0.0.1").WithProviderSpecific(providerSpecificComments, "[external-dns] owner=default")
+	err = provider.ApplyChanges(context.Background(), &plan.Changes{
+		Delete: []*endpoint.Endpoint{owned, endpoint.NewEndpoint("manual.a.au", "A", "10.0.0.2")},
+	})
+	require.ErrorContains(t, err, "delete manual.a.au A: refusing to delete records not marked as managed by external-dns")
+	require.Equal(t, deletes+1, len(deletedRecords))
+	require.Equal(t, "owned.a.au", deletedRecords[len(deletedRecords)-1].Name)
+
+	err = provider.ApplyChanges(context.Background(), &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpoint("manual.a.au", "A", "10.0.0.2")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpoint("manual.a.au", "A", "10.0.0.3")},
+	})
+	require.ErrorContains(t, err, "update manual.a.au A 10.0.0.3: refusing to delete records not marked")
+}
+
+func TestAdjustEndpointsReportedProperties(t *testing.T) {
+	provider := &Provider{client: mockDnsService{}}
+	provider.setReported([]*endpoint.Endpoint{
+		endpoint.NewEndpoint("a.au", "A", "1.1.1.1").WithProviderSpecific(providerSpecificComments, "[external-dns] owner=default"),
+		endpoint.NewEndpoint("b.au", "A", "2.2.2.2").WithProviderSpecific(providerSpecificComments, "by hand"),
+	}, nil)
+
+	endpoints, err := provider.AdjustEndpoints([]*endpoint.Endpoint{
+		endpoint.NewEndpoint("A.au.", "A", "1.1.1.1"),
+		endpoint.NewEndpoint("b.au", "A", "2.2.2.2").WithProviderSpecific(providerSpecificComments, "desired"),
+		endpoint.NewEndpoint("a.au", "CNAME", "b.au"),
+	})
+	require.NoError(t, err)
+	comment, _ := endpoints[0].GetProviderSpecificProperty(providerSpecificComments)
+	require.Equal(t, "[external-dns] owner=default", comment)
+	comment, _ = endpoints[1].GetProviderSpecificProperty(providerSpecificComments)
+	require.Equal(t, "desired", comment)
+	_, ok := endpoints[2].GetProviderSpecificProperty(providerSpecificComments)
+	require.False(t, ok)
+}
+
+func TestRecordOptions(t *testing.T) {
+	comments, err := parseCommentTemplate("owner={{.OwnerID}}")
+	require.NoError(t, err)
+	provider := &Provider{client: mockDnsService{}, comments: comments}
+
+	e := endpoint.NewEndpoint("opts.a.au", "A", "10.0.0.1").
+		WithProviderSpecific(providerSpecificComments, "hello").
+		WithProviderSpecific(providerSpecificExpiryTTL, "600").
+		WithProviderSpecific(providerSpecificDisabled, "true").
+		WithProviderSpecific(providerSpecificPTR, "true").
+		WithProviderSpecific(providerSpecificCreatePTRZone, "false")
+	err = provider.ApplyChanges(context.Background(), &plan.Changes{Create: []*endpoint.Endpoint{e}})
+	require.NoError(t, err)
+	created := createdRecords[len(createdRecords)-1]
+	require.Equal(t, "[external-dns] owner=\nhello", *created.Comments)
+	require.Equal(t, 600, *created.ExpiryTTL)
+	require.True(t, *created.Disable)
+	require.True(t, *created.PTR)
+	require.False(t, *created.CreatePTRZone)
+
+	// the options round-trip through Records
+	ip := "10.0.0.1"
+	read := recordToEndpoint(sdk.Record{
+		Name:      "opts.a.au",
+		Type:      "A",
+		RData:     sdk.RData{IPAddress: &ip},
+		Comments:  *created.Comments,
+		ExpiryTTL: *created.ExpiryTTL,
+		Disabled:  *created.Disable,
+	})
+	// Records adds the PTR state
+	read.SetProviderSpecificProperty(providerSpecificPTR, "true")
+	require.True(t, sameProperties(e, read))
+
+	// a property only change updates the record in place
+	updated := read.DeepCopy()
+	updated.DeleteProviderSpecificProperty(providerSpecificDisabled)
+	err = provider.ApplyChanges(context.Background(), &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{read},
+		UpdateNew: []*endpoint.Endpoint{updated},
+	})
+	require.NoError(t, err)
+	require.False(t, *updatedRecords[len(updatedRecords)-1].new.Disable)
+
+	for name, value := range map[string]string{
+		providerSpecificExpiryTTL:     "-1",
+		providerSpecificDisabled:      "maybe",
+		providerSpecificCreatePTRZone: "maybe",
+		providerSpecificZone:          "c.au",
+	} {
+		err = provider.ApplyChanges(context.Background(), &plan.Changes{
+			Create: []*endpoint.Endpoint{endpoint.NewEndpoint("opts.a.au", "A", "10.0.0.1").
+				WithProviderSpecific(providerSpecificPTR, "true").
+				WithProviderSpecific(name, value)},
+		})
+		require.ErrorContains(t, err, "invalid "+name+" property")
+	}
+}
+
+func TestZoneProperty(t *testing.T) {
+	zones := newZoneIndex([]sdk.Zone{{Name: "example.com"}, {Name: "k8s.example.com"}})
+
+	zone, err := endpointZone(zones, endpoint.NewEndpoint("app.k8s.example.com", "A", "10.0.0.1"))
+	require.NoError(t, err)
+	require.Equal(t, "k8s.example.com", zone)
+
+	zone, err = endpointZone(zones, endpoint.NewEndpoint("app.k8s.example.com", "A", "10.0.0.1").
+		WithProviderSpecific(providerSpecificZone, "example.com."))
+	require.NoError(t, err)
+	require.Equal(t, "example.com", zone)
+
+	_, err = endpointZone(zones, endpoint.NewEndpoint("app.example.org", "A", "10.0.0.1").
+		WithProviderSpecific(providerSpecificZone, "example.com"))
+	require.ErrorContains(t, err, "app.example.org is not part of the zone")
+
+	// the zone is only reported when it is not the most specific one
+	provider := &Provider{client: mockDnsService{}}
+	ip := "10.0.0.1"
+	records := []sdk.Record{
+		{Zone: "example.com", Name: "app.k8s.example.com", Type: "A", RData: sdk.RData{IPAddress: &ip}},
+		{Zone: "k8s.example.com", Name: "k8s.example.com", Type: "A", RData: sdk.RData{IPAddress: &ip}},
+	}
+	indexed := recordZones(records)
+	require.Equal(t, zoneIndex{"example.com": "example.com", "k8s.example.com": "k8s.example.com"}, indexed)
+	provider.setReported([]*endpoint.Endpoint{
+		endpoint.NewEndpoint("app.k8s.example.com", "A", "10.0.0.1").WithProviderSpecific(providerSpecificZone, "example.com"),
+	}, indexed)
+
+	endpoints, err := provider.AdjustEndpoints([]*endpoint.Endpoint{
+		endpoint.NewEndpoint("app.k8s.example.com", "A", "10.0.0.1"),
+		endpoint.NewEndpoint("www.k8s.example.com", "A", "10.0.0.1").WithProviderSpecific(providerSpecificZone, "k8s.example.com"),
+	})
+	require.NoError(t, err)
+	zone, _ = endpoints[0].GetProviderSpecificProperty(providerSpecificZone)
+	require.Equal(t, "example.com", zone)
+	_, ok := endpoints[1].GetProviderSpecificProperty(providerSpecificZone)
+	require.False(t, ok)
+}
+
+func TestAdjustEndpointsProperties(t *testing.T) {
+	provider := &Provider{client: mockDnsService{}, createPTR: true}
+	provider.setReported([]*endpoint.Endpoint{
+		endpoint.NewEndpoint("a.au", "A", "1.1.1.1").WithProviderSpecific(providerSpecificComments, "[external-dns] owner=default\nhello"),
+	}, nil)
+
+	endpoints, err := provider.AdjustEndpoints([]*endpoint.Endpoint{
+		endpoint.NewEndpoint("a.au", "A", "1.1.1.1").
+			WithProviderSpecific(providerSpecificComments, "hello").
+			WithProviderSpecific(providerSpecificPTR, "TRUE").
+			WithProviderSpecific(providerSpecificCreatePTRZone, "false").
+			WithProviderSpecific(providerSpecificDisabled, "false").
+			WithProviderSpecific(providerSpecificExpiryTTL, "0"),
+		endpoint.NewEndpoint("new.a.au", "A", "1.1.1.1").
+			WithProviderSpecific(providerSpecificPTR, "False").
+			WithProviderSpecific(providerSpecificCreatePTRZone, "false").
+			WithProviderSpecific(providerSpecificDisabled, "1"),
+	})
+	require.NoError(t, err)
+	require.Equal(t, endpoint.ProviderSpecific{
+		{Name: providerSpecificComments, Value: "[external-dns] owner=default\nhello"},
+	}, endpoints[0].ProviderSpecific)
+	require.Equal(t, endpoint.ProviderSpecific{
+		{Name: providerSpecificPTR, Value: "false"},
+		{Name: providerSpecificCreatePTRZone, Value: "false"},
+		{Name: providerSpecificDisabled, Value: "true"},
+	}, endpoints[1].ProviderSpecific)
+}
+
+func TestDisabledRecords(t *testing.T) {
+	ip := "10.0.0.1"
+	disabled := sdk.Record{Zone: "a.au", Name: "off.a.au", Type: "A", TTL: 300, RData: sdk.RData{IPAddress: &ip}, Disabled: true}
+	client := disabledRecordsService{mockDnsService: mockDnsService{}, records: []sdk.Record{disabled}}
+
+	desired := func() []*endpoint.Endpoint {
+		return []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("off.a.au", "A", 300, "10.0.0.1")}
+	}
+
+	provider := &Provider{client: client, disabledRecords: disabledHide}
+	endpoints, err := provider.Records(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, endpoints)
+
+	// creating a hidden record enables it in place
+	createdRecords, enabledRecords = nil, nil
+	changes := syncPlan(t, provider, desired())
+	require.Len(t, changes.Create, 1)
+	require.NoError(t, provider.ApplyChanges(context.Background(), changes))
+	require.Empty(t, createdRecords)
+	require.Len(t, enabledRecords, 1)
+	require.Equal(t, "off.a.au", enabledRecords[0].Name)
+	require.False(t, enabledRecords[0].Disabled)
+
+	// and disables it again on rollback
+	enabledRecords, updatedRecords = nil, nil
+	provider.transactional = true
+	changes.Create = append(changes.Create, endpoint.NewEndpoint("fail.a.au", "A", "10.0.0.2"))
+	provider.client = disabledRecordsService{mockDnsService: mockDnsService{failName: "fail.a.au"}, records: client.records}
+	require.Error(t, provider.ApplyChanges(context.Background(), changes))
+	require.Len(t, enabledRecords, 1)
+	require.Len(t, updatedRecords, 1)
+	require.True(t, *updatedRecords[0].new.Disable)
+	for _, policy := range []string{disabledReport, disabledEnable} {
+		provider = &Provider{client: client, disabledRecords: policy}
+		endpoints, err = provider.Records(context.Background())
+		require.NoError(t, err)
+		require.Len(t, endpoints, 1)
+		value, _ := endpoints[0].GetProviderSpecificProperty(providerSpecificDisabled)
+		require.Equal(t, "true", value)
+
+		adjusted, err := provider.AdjustEndpoints(desired())
+		require.NoError(t, err)
+		_, ok := adjusted[0].GetProviderSpecificProperty(providerSpecificDisabled)
+		// reported records stay disabled, the others are enabled by the plan
+		require.Equal(t, policy == disabledReport, ok, policy)
+		require.Equal(t, policy == disabledReport, sameEndpoints(*endpoints[0], *adjusted[0]), policy)
+	}
+
+	// enabling a record updates it in place
+	err = provider.ApplyChanges(context.Background(), &plan.Changes{
+		UpdateOld: endpoints,
+		UpdateNew: desired(),
+	})
+	require.NoError(t, err)
+	updated := updatedRecords[len(updatedRecords)-1]
+	require.True(t, updated.old.Disabled)
+	require.False(t, *updated.new.Disable)
+}
+
+// disabledRecordsService serves a fixed set of records.
+type disabledRecordsService struct {
+	mockDnsService
+	records []sdk.Record
+}
+
+func (m disabledRecordsService) GetRecords(ctx context.Context) ([]sdk.Record, error) {
+	return m.records, nil
+}
+
+func TestRecordCache(t *testing.T) {
+	ip := "10.0.0.1"
+	client := &zoneService{serial: 1, records: []sdk.Record{
+		{Zone: "a.au", Name: "one.a.au", Type: "A", TTL: 300, RData: sdk.RData{IPAddress: &ip}},
+	}}
+	provider := &Provider{client: client, cache: newRecordCache(time.Minute)}
+	names := func() []string {
+		endpoints, err := provider.Records(context.Background())
+		require.NoError(t, err)
+		var names []string
+		for _, e := range endpoints {
+			names = append(names, e.DNSName)
+		}
+		return names
+	}
+
+	require.Equal(t, []string{"one.a.au"}, names())
+	require.Equal(t, []string{"one.a.au"}, names())
+	require.Equal(t, 1, client.listed)
+
+	// applied changes are mirrored without listing again
+	err := provider.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("two.a.au", "A", 300, "10.0.0.2")},
+		Delete: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("one.a.au", "A", 300, "10.0.0.1")},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"two.a.au"}, names())
+	require.Equal(t, 1, client.listed)
+
+	// changes made out of band refresh the cache
+	client.records = append(client.records, sdk.Record{Zone: "a.au", Name: "three.a.au", Type: "A", TTL: 300, RData: sdk.RData{IPAddress: &ip}})
+	client.serial++
+	require.Equal(t, []string{"two.a.au", "three.a.au"}, names())
+	require.Equal(t, 2, client.listed)
+
+	// so does an expired cache
+	provider.cache.fetched = time.Now().Add(-time.Minute)
+	names()
+	require.Equal(t, 3, client.listed)
+
+	// changes made out of band before changes are applied are not absorbed
+	// by the applied changes
+	client.records = append(client.records, sdk.Record{Zone: "a.au", Name: "manual.a.au", Type: "A", TTL: 300, RData: sdk.RData{IPAddress: &ip}})
+	client.serial++
+	err = provider.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("five.a.au", "A", 300, "10.0.0.5")},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"two.a.au", "three.a.au", "manual.a.au", "five.a.au"}, names())
+	require.Equal(t, 4, client.listed)
+
+	// failed batches drop the cache
+	client.fail = true
+	err = provider.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("four.a.au", "A", 300, "10.0.0.4")},
+	})
+	require.Error(t, err)
+	client.fail = false
+	names()
+	require.Equal(t, 5, client.listed)
+}
+
+// zoneService serves the records of a single zone, whose serial changes with
+// every write.
+type zoneService struct {
+	mockDnsService
+	records []sdk.Record
+	serial  int
+	listed  int
+	fail    bool
+}
+
+func (m *zoneService) GetZones(ctx context.Context) ([]sdk.Zone, error) {
+	return []sdk.Zone{{Name: "a.au", Type: "Primary", SOASerial: &m.serial}}, nil
+}
+
+func (m *zoneService) GetRecords(ctx context.Context) ([]sdk.Record, error) {
+	m.listed++
+	return slices.Clone(m.records), nil
+}
+
+func (m *zoneService) CreateRecord(ctx context.Context, r *sdk.RecordRequest) error {
+	if m.fail {
+		return fmt.Errorf("failed to create %s", r.Domain)
+	}
+	m.serial++
+	m.records = append(m.records, sdk.Record{Zone: "a.au", Name: r.Domain, Type: r.Type, TTL: *r.TTL, RData: sdk.RData{IPAddress: r.IPAddress}})
+	return nil
+}
+
+func (m *zoneService) DeleteRecord(ctx context.Context, r *sdk.Record) error {
+	m.serial++
+	m.records = slices.DeleteFunc(m.records, func(c sdk.Record) bool { return sameRecord(c, *r) })
+	return nil
+}
+
+func TestMXRecords(t *testing.T) {
+	preference := 10
+	exchange := "mail.a.au."
+	e := recordToEndpoint(sdk.Record{
+		Name:  "a.au",
+		Type:  "MX",
+		TTL:   3600,
+		RData: sdk.RData{Preference: &preference, Exchange: &exchange},
+	})
+	require.NotNil(t, e)
+	require.Equal(t, endpoint.Targets{"10 mail.a.au"}, e.Targets)
+
+	provider := &Provider{client: mockDnsService{}}
+	err := provider.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{{DNSName: "mx.a.au", RecordType: "MX", Targets: endpoint.Targets{"20 mail2.a.au"}}},
+		Delete: []*endpoint.Endpoint{{DNSName: "a.au", RecordType: "MX", Targets: endpoint.Targets{"10 mail.a.au"}}},
+	})
+	require.NoError(t, err)
+	require.True(t, isRecordCreated("mx.a.au", "MX", "20 mail2.a.au", 0))
+
+	deleted := deletedRecords[len(deletedRecords)-1]
+	require.Equal(t, 10, *deleted.RData.Preference)
+	require.Equal(t, "mail.a.au", *deleted.RData.Exchange)
+
+	err = provider.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{{DNSName: "mx.a.au", RecordType: "MX", Targets: endpoint.Targets{"mail2.a.au"}}},
+	})
+	require.ErrorContains(t, err, "invalid MX target")
+}
+
+func TestSRVRecords(t *testing.T) {
+	priority, weight, port := 10, 5, 5060
+	target := "sip.a.au."
+	e := recordToEndpoint(sdk.Record{
+		Name:  "_sip._tcp.a.au",
+		Type:  "SRV",
+		TTL:   3600,
+		RData: sdk.RData{Priority: &priority, Weight: &weight, Port: &port, Target: &target},
+	})
+	require.NotNil(t, e)
+	require.Equal(t, endpoint.Targets{"10 5 5060 sip.a.au"}, e.Targets)
+
+	provider := &Provider{client: mockDnsService{}}
+	err := provider.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{{DNSName: "_sip._udp.a.au", RecordType: "SRV", Targets: endpoint.Targets{"20 0 5060 sip2.a.au"}}},
+		Delete: []*endpoint.Endpoint{{DNSName: "_sip._tcp.a.au", RecordType: "SRV", Targets: endpoint.Targets{"10 5 5060 sip.a.au"}}},
+	})
+	require.NoError(t, err)
+	require.True(t, isRecordCreated("_sip._udp.a.au", "SRV", "20 0 5060 sip2.a.au", 0))
+
+	// delete must match the exact tuple
+	deleted := deletedRecords[len(deletedRecords)-1]
+	require.Equal(t, 10, *deleted.RData.Priority)
+	require.Equal(t, 5, *deleted.RData.Weight)
+	require.Equal(t, 5060, *deleted.RData.Port)
+	require.Equal(t, "sip.a.au", *deleted.RData.Target)
+
+	err = provider.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{{DNSName: "_sip._udp.a.au", RecordType: "SRV", Targets: endpoint.Targets{"10 x 5060 sip.a.au"}}},
+	})
+	require.ErrorContains(t, err, "invalid SRV target")
+}
+
+func TestCAARecords(t *testing.T) {
+	flags := 0
+	tag := "iodef"
+	value := `mailto:"ca"\admin@a.au`
+	e := recordToEndpoint(sdk.Record{
+		Name:  "a.au",
+		Type:  "CAA",
+		TTL:   3600,
+		RData: sdk.RData{Flags: &flags, Tag: &tag, Value: &value},
+	})
+	require.NotNil(t, e)
+	require.Equal(t, endpoint.Targets{`0 iodef "mailto:\"ca\"\\admin@a.au"`}, e.Targets)
+
+	// the presentation format round trips
+	rdata, err := targetToRData("CAA", e.Targets[0])
+	require.NoError(t, err)
+	require.Equal(t, value, *rdata.Value)
+
+	rdata, err = targetToRData("CAA", "128 issue letsencrypt.org")
+	require.NoError(t, err)
+	require.Equal(t, 128, *rdata.Flags)
+	require.Equal(t, "issue", *rdata.Tag)
+	require.Equal(t, "letsencrypt.org", *rdata.Value)
+
+	for _, target := range []string{`0 issue`, `x issue "ca"`, `0 issue "ca`, `0 issue "ca" x`, `256 issue "ca"`} {
+		_, err := targetToRData("CAA", target)
+		require.Errorf(t, err, "target %s should be rejected", target)
+	}
+
+	provider := &Provider{client: mockDnsService{}}
+	err = provider.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{{DNSName: "a.au", RecordType: "CAA", Targets: endpoint.Targets{`0 issue "letsencrypt.org"`}}},
+		Delete: []*endpoint.Endpoint{{DNSName: "a.au", RecordType: "CAA", Targets: endpoint.Targets{`0 issue "digicert.com"`}}},
+	})
+	require.NoError(t, err)
+	require.True(t, isRecordCreated("a.au", "CAA", `0 issue "letsencrypt.org"`, 0))
+
+	deleted := deletedRecords[len(deletedRecords)-1]
+	require.Equal(t, "issue", *deleted.RData.Tag)
+	require.Equal(t, "digicert.com", *deleted.RData.Value)
+}
+
+func TestNSRecords(t *testing.T) {
+	provider := &Provider{client: mockDnsService{}}
+
+	delegation := endpoint.NewEndpoint("team.a.au", "NS", "ns1.team.a.au", "ns2.team.a.au").
+		WithProviderSpecific(providerSpecificGlue, "ns1.team.a.au=10.0.0.1, ns1.team.a.au=fd00::1")
+	err := provider.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{delegation},
+	})
+	require.NoError(t, err)
+
+	created := createdRecords[len(createdRecords)-2:]
+	require.Equal(t, "ns1.team.a.au", *created[0].NameServer)
+	require.Equal(t, "10.0.0.1,fd00::1", *created[0].Glue)
+	require.Equal(t, "ns2.team.a.au", *created[1].NameServer)
+	require.Nil(t, created[1].Glue)
+
+	// apex name servers are protected, delegations can be deleted
+	err = provider.ApplyChanges(context.Background(), &plan.Changes{
+		Delete: []*endpoint.Endpoint{
+			endpoint.NewEndpoint("a.au", "NS", "ns1.a.au"),
+			endpoint.NewEndpoint("team.a.au", "NS", "ns1.team.a.au"),
+		},
+	})
+	require.ErrorContains(t, err, "refusing to delete the name servers of zone a.au")
+	require.Equal(t, "ns1.team.a.au", *deletedRecords[len(deletedRecords)-1].RData.NameServer)
+
+	// and are neither created nor updated
+	creates, updates := len(createdRecords), len(updatedRecords)
+	err = provider.ApplyChanges(context.Background(), &plan.Changes{
+		Create:    []*endpoint.Endpoint{endpoint.NewEndpoint("a.au", "NS", "ns9.a.au")},
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpoint("b.au", "NS", "ns1.b.au")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpoint("b.au", "NS", "ns2.b.au")},
+	})
+	require.ErrorContains(t, err, "create a.au NS: refusing to create the name servers of zone a.au")
+	require.ErrorContains(t, err, "update b.au NS: refusing to update the name servers of zone b.au")
+	require.Equal(t, creates, len(createdRecords))
+	require.Equal(t, updates, len(updatedRecords))
+
+	_, err = endpointToRecords(delegation.WithProviderSpecific(providerSpecificGlue, "10.0.0.1"))
+	require.ErrorContains(t, err, "invalid glue")
+}
+
+func TestPTRRecords(t *testing.T) {
+	provider := &Provider{client: mockDnsService{}}
+
+	err := provider.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpoint("ptr.a.au", "A", "10.1.2.3").WithProviderSpecific(providerSpecificPTR, "true"),
+			endpoint.NewEndpoint("noptr.a.au", "A", "10.1.2.4"),
+		},
+		Delete: []*endpoint.Endpoint{
+			endpoint.NewEndpoint("old.a.au", "AAAA", "2001:db8::1").WithProviderSpecific(providerSpecificPTR, "true"),
+		},
+	})
+	require.NoError(t, err)
+
+	created := createdRecords[len(createdRecords)-2:]
+	require.True(t, *created[0].PTR)
+	require.True(t, *created[0].CreatePTRZone)
+	require.Nil(t, created[1].PTR)
+
+	deleted := deletedRecords[len(deletedRecords)-2:]
+	require.Equal(t, "old.a.au", deleted[0].Name)
+	require.Equal(t, "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa", deleted[1].Name)
+	require.Equal(t, "PTR", deleted[1].Type)
+	require.Equal(t, "old.a.au", *deleted[1].RData.PTRName)
+
+	// the global setting applies unless overridden
+	provider = &Provider{client: mockDnsService{}, createPTR: true}
+	err = provider.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpoint("ptr.a.au", "A", "10.1.2.3"),
+			endpoint.NewEndpoint("noptr.a.au", "A", "10.1.2.4").WithProviderSpecific(providerSpecificPTR, "false"),
+			endpoint.NewEndpoint("cname.a.au", "CNAME", "a.au"),
+		},
+	})
+	require.NoError(t, err)
+
+	created = createdRecords[len(createdRecords)-3:]
+	require.True(t, *created[0].PTR)
+	require.Nil(t, created[1].PTR)
+	require.Nil(t, created[2].PTR)
+
+	name, err := reverseName("192.0.2.10")
+	require.NoError(t, err)
+	require.Equal(t, "10.2.0.192.in-addr.arpa", name)
+}
+
+func TestZonePlacement(t *testing.T) {
+	zones := newZoneIndex([]sdk.Zone{{Name: "example.com"}, {Name: "k8s.example.com"}, {Name: ""}})
+
+	zone, ok := zones.find("app.k8s.example.com")
+	require.True(t, ok)
+	require.Equal(t, "k8s.example.com", zone)
+	zone, ok = zones.find("www.Example.com.")
+	require.True(t, ok)
+	require.Equal(t, "example.com", zone)
+	_, ok = zones.find("example.org")
+	require.False(t, ok)
+
+	provider := &Provider{client: mockDnsService{}}
+	err := provider.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpoint("placed.a.au", "A", "10.0.0.1"),
+			endpoint.NewEndpoint("unknown.c.au", "A", "10.0.0.2"),
+		},
+		Delete: []*endpoint.Endpoint{endpoint.NewEndpoint("old.b.au", "A", "10.0.0.3")},
+	})
+	require.ErrorContains(t, err, "create unknown.c.au A: no managed zone found for unknown.c.au")
+
+	require.Equal(t, "a.au", *createdRecords[len(createdRecords)-1].Zone)
+	require.Equal(t, "b.au", deletedRecords[len(deletedRecords)-1].Zone)
+}
+
+func (m mockDnsService) GetZones(ctx context.Context) ([]sdk.Zone, error) {
 	if m.testErrorReturned {
 		return nil, fmt.Errorf("GetZones failed")
 	}
@@ -91,7 +1277,7 @@ func (m mockDnsService) GetZones() ([]sdk.Zone, error) {
 	return []sdk.Zone{*a, *b}, nil
 }
 
-func (m mockDnsService) GetRecords() ([]sdk.Record, error) {
+func (m mockDnsService) GetRecords(ctx context.Context) ([]sdk.Record, error) {
 	if m.testErrorReturned {
 		return nil, fmt.Errorf("GetZone failed")
 	}
@@ -128,22 +1314,89 @@ func (m mockDnsService) GetRecords() ([]sdk.Record, error) {
 		DNSSecStatus: "Unknown",
 	}
 
-	records = append(records, a, a2, b)
+	nameServer1 := "ns1.a.au"
+	apex := sdk.Record{
+		Zone:  "a.au",
+		Name:  "a.au",
+		Type:  "NS",
+		TTL:   3600,
+		RData: sdk.RData{NameServer: &nameServer1},
+	}
+
+	nameServer2 := "ns1.team.a.au"
+	delegation := sdk.Record{
+		Zone:  "a.au",
+		Name:  "team.a.au",
+		Type:  "NS",
+		TTL:   3600,
+		RData: sdk.RData{NameServer: &nameServer2, Glue: []string{"10.0.0.1"}},
+	}
+
+	ptrName := "a.au"
+	ptr := sdk.Record{
+		Zone:  "1.in-addr.arpa",
+		Name:  "1.1.1.1.in-addr.arpa",
+		Type:  "PTR",
+		TTL:   3600,
+		RData: sdk.RData{PTRName: &ptrName},
+	}
+
+	ptr2 := ptr
+	ptr2.Name = "2.1.1.1.in-addr.arpa"
+
+	records = append(records, a, a2, b, apex, delegation, ptr, ptr2)
 
 	return records, nil
 }
 
-func (m mockDnsService) CreateRecord(record *sdk.RecordRequest) error {
+func (m mockDnsService) GetDomainRecords(ctx context.Context, zone, domain string) ([]sdk.Record, error) {
+	records, err := m.GetRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var domainRecords []sdk.Record
+	for _, r := range records {
+		if r.Name == domain {
+			r.Zone = zone
+			domainRecords = append(domainRecords, r)
+		}
+	}
+	return domainRecords, nil
+}
+
+func (m mockDnsService) CreateRecord(ctx context.Context, record *sdk.RecordRequest) error {
+	if m.testErrorReturned || m.failChanges || record.Domain == m.failName {
+		return fmt.Errorf("CreateRecord failed")
+	}
 	createdRecords = append(createdRecords, *record)
 	return nil
 }
 
-func (m mockDnsService) DeleteRecord(record *sdk.Record) error {
+func (m mockDnsService) DeleteRecord(ctx context.Context, record *sdk.Record) error {
+	if m.testErrorReturned || m.failChanges || record.Name == m.failName {
+		return fmt.Errorf("DeleteRecord failed")
+	}
 	log.Infof("Deleting: %v", record)
 	deletedRecords = append(deletedRecords, *record)
 	return nil
 }
 
+func (m mockDnsService) UpdateRecord(ctx context.Context, old *sdk.Record, record *sdk.RecordRequest) error {
+	if m.testErrorReturned || m.failChanges || record.Domain == m.failName {
+		return fmt.Errorf("UpdateRecord failed")
+	}
+	updatedRecords = append(updatedRecords, updatedRecord{old: *old, new: *record})
+	return nil
+}
+
+func (m mockDnsService) EnableRecord(ctx context.Context, record *sdk.Record) error {
+	if m.testErrorReturned || m.failChanges || record.Name == m.failName {
+		return fmt.Errorf("EnableRecord failed")
+	}
+	enabledRecords = append(enabledRecords, *record)
+	return nil
+}
+
 func changes() *plan.Changes {
 	changes := &plan.Changes{}
 
@@ -160,14 +1413,39 @@ func changes() *plan.Changes {
 var (
 	createdRecords = []sdk.RecordRequest{}
 	deletedRecords = []sdk.Record{}
+	updatedRecords = []updatedRecord{}
+	enabledRecords = []sdk.Record{}
 )
 
+type updatedRecord struct {
+	old sdk.Record
+	new sdk.RecordRequest
+}
+
 func isRecordCreated(name string, recordType string, content string, ttl int) bool {
 	for _, record := range createdRecords {
-		if record.Domain == name && record.Type == recordType && *record.IPAddress == content && (ttl == 0 || *record.TTL == ttl) {
+		if record.Domain == name && record.Type == recordType && requestContent(record) == content && (ttl == 0 || *record.TTL == ttl) {
 			return true
 		}
 	}
 
 	return false
 }
+
+func requestContent(r sdk.RecordRequest) string {
+	switch r.Type {
+	case "A", "AAAA":
+		return *r.IPAddress
+	case "CNAME":
+		return *r.CNAME
+	case "TXT":
+		return *r.Text
+	case "MX":
+		return fmt.Sprintf("%d %s", *r.Preference, *r.Exchange)
+	case "SRV":
+		return fmt.Sprintf("%d %d %d %s", *r.Priority, *r.Weight, *r.Port, *r.Target)
+	case "CAA":
+		return formatCAA(*r.Flags, *r.Tag, *r.Value)
+	}
+	return ""
+}
@@ -0,0 +1,108 @@
+package technitium
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/external-dns/endpoint"
+
+	sdk "github.com/chrisatcho/external-dns-technitiumdns-webhook/pkg/sdk"
+)
+
+// rollbackTimeout bounds the time spent undoing a failed batch, which runs
+// even when the request context is already done
+const rollbackTimeout = 30 * time.Second
+
+// journal records the inverse of every change applied in a transactional
+// batch, so a failed batch can be undone.
+type journal struct {
+	entries []journalEntry
+}
+
+type journalEntry struct {
+	change string
+	undo   func(ctx context.Context) error
+}
+
+// record adds the inverse of the applied change. It is a no-op on a nil
+// journal, which is the case outside of transactional batches.
+func (j *journal) record(change string, undo func(ctx context.Context) error) {
+	if j == nil {
+		return
+	}
+	j.entries = append(j.entries, journalEntry{change: change, undo: undo})
+}
+
+// rollback undoes the recorded changes in reverse order. Every inverse is
+// attempted, the failed ones are reported together.
+func (j *journal) rollback(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+
+	var errs []error
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		if err := j.entries[i].undo(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("undo %s: %w", j.entries[i].change, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("rollback failed for %d of %d changes: %w", len(errs), len(j.entries), errors.Join(errs...))
+	}
+	return nil
+}
+
+// snapshot holds the records of the names touched by a batch as they were
+// before it was applied, so deleted and updated records are restored with
+// their original TTL and data. Records are kept by zone and name.
+type snapshot map[string][]sdk.Record
+
+// takeSnapshot lists the records of every name of endpoints in the zone they
+// are placed in.
+func (p *Provider) takeSnapshot(ctx context.Context, zones zoneIndex, endpoints []*endpoint.Endpoint) (snapshot, error) {
+	s := make(snapshot)
+	for _, e := range endpoints {
+		zone, err := endpointZone(zones, e)
+		if err != nil {
+			// the change itself reports the missing zone
+			continue
+		}
+		name := strings.ToLower(strings.TrimSuffix(e.DNSName, "."))
+		key := snapshotKey(zone, name)
+		if _, ok := s[key]; ok {
+			continue
+		}
+		records, err := p.client.GetDomainRecords(ctx, zone, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to snapshot %s: %w", name, err)
+		}
+		s[key] = records
+	}
+	return s, nil
+}
+
+// find returns the snapshot of r, or r itself when it was not snapshotted.
+func (s snapshot) find(r sdk.Record) sdk.Record {
+	target, ok := rdataToTarget(r)
+	if !ok {
+		return r
+	}
+	for _, c := range s[snapshotKey(r.Zone, r.Name)] {
+		if c.Type != r.Type {
+			continue
+		}
+		if t, ok := rdataToTarget(c); ok && targetKey(c.Type, t) == targetKey(r.Type, target) {
+			if c.Zone == "" {
+				c.Zone = r.Zone
+			}
+			return c
+		}
+	}
+	return r
+}
+
+func snapshotKey(zone, name string) string {
+	return strings.ToLower(strings.TrimSuffix(zone, ".")) + "/" + strings.ToLower(strings.TrimSuffix(name, "."))
+}
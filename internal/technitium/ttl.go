@@ -0,0 +1,59 @@
+package technitium
+
+import (
+	"strings"
+)
+
+// defaultTTL is the TTL Technitium gives records created without one, used
+// when no default TTL is configured.
+const defaultTTL = 3600
+
+// ttlPolicy decides the TTL records are written with. Endpoints without a TTL
+// get the default TTL of their zone, or the global one, and every TTL is
+// clamped to the configured bounds.
+type ttlPolicy struct {
+	defaultTTL int
+	minTTL     int
+	maxTTL     int
+	// zones indexes the zones with their own default TTL in zoneTTLs
+	zones    zoneIndex
+	zoneTTLs map[string]int
+}
+
+// newTTLPolicy builds the TTL policy of the configuration.
+func newTTLPolicy(c *Configuration) ttlPolicy {
+	t := ttlPolicy{
+		defaultTTL: c.DefaultTTL,
+		minTTL:     c.MinTTL,
+		maxTTL:     c.MaxTTL,
+		zones:      zoneIndex{},
+		zoneTTLs:   map[string]int{},
+	}
+	for zone, ttl := range c.ZoneTTLs {
+		zone = strings.ToLower(strings.TrimSuffix(zone, "."))
+		t.zones[zone] = zone
+		t.zoneTTLs[zone] = ttl
+	}
+	return t
+}
+
+// apply returns the TTL a record of name is written with when ttl is
+// requested, 0 meaning none.
+func (t ttlPolicy) apply(name string, ttl int) int {
+	if ttl <= 0 {
+		ttl = t.defaultTTL
+		if zone, ok := t.zones.find(name); ok {
+			ttl = t.zoneTTLs[zone]
+		}
+		if ttl <= 0 {
+			ttl = defaultTTL
+		}
+	}
+	if t.minTTL > 0 && ttl < t.minTTL {
+		ttl = t.minTTL
+	}
+	if t.maxTTL > 0 && ttl > t.maxTTL {
+		ttl = t.maxTTL
+	}
+	return ttl
+}
@@ -0,0 +1,149 @@
+package technitium
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+
+	sdk "github.com/chrisatcho/external-dns-technitiumdns-webhook/pkg/sdk"
+)
+
+// zoneIndex resolves names to the most specific zone hosting them. It maps
+// lower case zone names to their names as listed by Technitium.
+type zoneIndex map[string]string
+
+// newZoneIndex indexes zones by name. The root zone is never used for
+// placement.
+func newZoneIndex(zones []sdk.Zone) zoneIndex {
+	idx := zoneIndex{}
+	for _, zone := range zones {
+		name := strings.ToLower(strings.TrimSuffix(zone.Name, "."))
+		if name == "" {
+			continue
+		}
+		idx[name] = zone.Name
+	}
+	return idx
+}
+
+// recordZones indexes the zones records were listed from.
+func recordZones(records []sdk.Record) zoneIndex {
+	idx := zoneIndex{}
+	for _, r := range records {
+		if name := strings.ToLower(strings.TrimSuffix(r.Zone, ".")); name != "" {
+			idx[name] = r.Zone
+		}
+	}
+	return idx
+}
+
+// find returns the zone with the longest suffix match for name.
+func (idx zoneIndex) find(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	for name != "" {
+		if zone, ok := idx[name]; ok {
+			return zone, true
+		}
+		_, parent, found := strings.Cut(name, ".")
+		if !found {
+			break
+		}
+		name = parent
+	}
+	return "", false
+}
+
+// endpointZone returns the zone the records of e are placed in, the zone
+// property overriding the most specific zone of the name.
+func endpointZone(zones zoneIndex, e *endpoint.Endpoint) (string, error) {
+	value, ok := e.GetProviderSpecificProperty(providerSpecificZone)
+	if !ok {
+		zone, ok := zones.find(e.DNSName)
+		if !ok {
+			return "", fmt.Errorf("no managed zone found for %s", e.DNSName)
+		}
+		return zone, nil
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(value, "."))
+	zone, ok := zones[name]
+	if !ok {
+		return "", fmt.Errorf("invalid %s property %q: no such zone", providerSpecificZone, value)
+	}
+	dnsName := strings.ToLower(strings.TrimSuffix(e.DNSName, "."))
+	if dnsName != name && !strings.HasSuffix(dnsName, "."+name) {
+		return "", fmt.Errorf("invalid %s property %q: %s is not part of the zone", providerSpecificZone, value, e.DNSName)
+	}
+	return zone, nil
+}
+
+// isApex reports whether name is the apex of a zone.
+func (idx zoneIndex) isApex(name string) bool {
+	_, ok := idx[strings.ToLower(strings.TrimSuffix(name, "."))]
+	return ok
+}
+
+// zoneTypes are the zone types known to Technitium
+var zoneTypes = []string{"Primary", "Secondary", "Stub", "Forwarder", "SecondaryForwarder", "Catalog", "SecondaryCatalog"}
+
+// zoneFilter selects the zones managed by the webhook by type. Internal,
+// disabled and expired zones are never managed.
+type zoneFilter struct {
+	// include lists the lower case managed types, all types when empty
+	include map[string]bool
+	// exclude lists the lower case types that are never managed
+	exclude map[string]bool
+}
+
+func newZoneFilter(include, exclude []string) zoneFilter {
+	return zoneFilter{include: zoneTypeSet(include), exclude: zoneTypeSet(exclude)}
+}
+
+func zoneTypeSet(types []string) map[string]bool {
+	set := make(map[string]bool, len(types))
+	for _, t := range types {
+		if t = strings.TrimSpace(t); t != "" {
+			set[strings.ToLower(t)] = true
+		}
+	}
+	return set
+}
+
+// match reports whether zone is managed.
+func (f zoneFilter) match(zone sdk.Zone) bool {
+	if zone.Disabled || (zone.Internal != nil && *zone.Internal) || (zone.IsExpired != nil && *zone.IsExpired) {
+		return false
+	}
+	t := strings.ToLower(zone.Type)
+	if f.exclude[t] {
+		return false
+	}
+	return len(f.include) == 0 || f.include[t]
+}
+
+// filter returns the managed zones.
+func (f zoneFilter) filter(zones []sdk.Zone) []sdk.Zone {
+	managed := make([]sdk.Zone, 0, len(zones))
+	for _, zone := range zones {
+		if !f.match(zone) {
+			log.Debugf("Skipping zone %s of type %s", zone.Name, zone.Type)
+			continue
+		}
+		managed = append(managed, zone)
+	}
+	return managed
+}
+
+// validZoneTypes checks that types only lists known zone types.
+func validZoneTypes(types []string) error {
+	for _, t := range types {
+		t = strings.TrimSpace(t)
+		if t != "" && !slices.ContainsFunc(zoneTypes, func(known string) bool { return strings.EqualFold(known, t) }) {
+			return fmt.Errorf("unknown zone type %q, must be one of %s", t, strings.Join(zoneTypes, ", "))
+		}
+	}
+	return nil
+}
@@ -1,10 +1,13 @@
 package sdk
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 )
 
 type RecordsAPIService service
@@ -14,16 +17,35 @@ type ListRecordsResponse struct {
 	Records []Record `json:"records"`
 }
 
-func (a *RecordsAPIService) ListRecords(domain string) ([]Record, *http.Response, error) {
+func (a *RecordsAPIService) ListRecords(ctx context.Context, domain string) ([]Record, *http.Response, error) {
+	q := url.Values{}
+	q.Set("domain", domain)
+	q.Set("listZone", "true")
+
+	return a.listRecords(ctx, q)
+}
+
+// ListDomainRecords lists the records of domain only, without the records of
+// its subdomains.
+func (a *RecordsAPIService) ListDomainRecords(ctx context.Context, zone, domain string) ([]Record, *http.Response, error) {
+	q := url.Values{}
+	q.Set("domain", domain)
+	if zone != "" {
+		q.Set("zone", zone)
+	}
+	q.Set("listZone", "false")
+
+	return a.listRecords(ctx, q)
+}
+
+func (a *RecordsAPIService) listRecords(ctx context.Context, q url.Values) ([]Record, *http.Response, error) {
 	reqURL := a.client.cfg.BaseURL + "/api/zones/records/get"
-	req, err := http.NewRequest(http.MethodGet, reqURL, nil)
+	// listing is read-only, so always safe to retry
+	req, err := http.NewRequestWithContext(WithRetry(ctx), http.MethodGet, reqURL, nil)
 	if err != nil {
 		return nil, nil, fmt.Errorf("new ListRecords request: %w", err)
 	}
 
-	q := url.Values{}
-	q.Set("domain", domain)
-	q.Set("listZone", "true")
 	req.URL.RawQuery = q.Encode()
 
 	res, err := a.client.callAPI(req)
@@ -42,7 +64,12 @@ func (a *RecordsAPIService) ListRecords(domain string) ([]Record, *http.Response
 		return nil, nil, fmt.Errorf("response ListRecords status not 'ok': %v, %v", body.Status, body.ErrorMessage)
 	}
 
-	return body.Data.Records, res, nil
+	records := body.Data.Records
+	for i := range records {
+		records[i].Zone = body.Data.Zone.Name
+	}
+
+	return records, res, nil
 }
 
 type CreateRecordResponse struct {
@@ -59,6 +86,7 @@ type RecordRequest struct {
 	Overwrite                      *bool   `json:"overwrite,omitempty"`
 	Comments                       *string `json:"comments,omitempty"`
 	ExpiryTTL                      *int    `json:"expiryTtl,omitempty"`
+	Disable                        *bool   `json:"disable,omitempty"`
 	IPAddress                      *string `json:"ipAddress,omitempty"`
 	PTR                            *bool   `json:"ptr,omitempty"`
 	CreatePTRZone                  *bool   `json:"createPtrZone,omitempty"`
@@ -122,9 +150,9 @@ type RecordRequest struct {
 	RData                          *string `json:"rdata,omitempty"`
 }
 
-func (a *RecordsAPIService) CreateRecord(r *RecordRequest) (*Record, *http.Response, error) {
+func (a *RecordsAPIService) CreateRecord(ctx context.Context, r *RecordRequest) (*Record, *http.Response, error) {
 	reqURL := a.client.cfg.BaseURL + `/api/zones/records/add`
-	req, err := http.NewRequest(http.MethodGet, reqURL, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
 	if err != nil {
 		return nil, nil, fmt.Errorf("new CreateRecord request: %w", err)
 	}
@@ -151,24 +179,11 @@ func (a *RecordsAPIService) CreateRecord(r *RecordRequest) (*Record, *http.Respo
 	return &body.Data.AddedRecord, res, nil
 }
 
-func (a *RecordsAPIService) DeleteRecord(r *Record) (*http.Response, error) {
-	q := url.Values{}
-	q.Set("domain", r.Name)
-	q.Set("type", r.Type)
-
-	switch r.Type {
-	case "A":
-		q.Set("ipAddress", *r.RData.IPAddress)
-	case "AAAA":
-		q.Set("ipAddress", *r.RData.IPAddress)
-	case "CNAME":
-		q.Set("cname", *r.RData.CNAME)
-	case "TXT":
-		q.Set("text", *r.RData.Text)
-	}
+func (a *RecordsAPIService) DeleteRecord(ctx context.Context, r *Record) (*http.Response, error) {
+	q := recordQuery(r)
 
 	url := a.client.cfg.BaseURL + `/api/zones/records/delete`
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("new DeleteRecord request: %w", err)
 	}
@@ -194,19 +209,199 @@ func (a *RecordsAPIService) DeleteRecord(r *Record) (*http.Response, error) {
 	return res, nil
 }
 
+type UpdateRecordResponse struct {
+	Zone          Zone   `json:"zone"`
+	UpdatedRecord Record `json:"updatedRecord"`
+}
+
+// UpdateRecord replaces the record old in place with the values of r. The
+// record data of r is sent as the new values of old, along with its TTL and
+// other options, so the record keeps resolving during the change.
+func (a *RecordsAPIService) UpdateRecord(ctx context.Context, old *Record, r *RecordRequest) (*Record, *http.Response, error) {
+	q := recordQuery(old)
+	if r.Domain != "" && !strings.EqualFold(r.Domain, old.Name) {
+		q.Set("newDomain", r.Domain)
+	}
+	for key, values := range structToQuery(r) {
+		switch key {
+		case "token", "domain", "zone", "type":
+			continue
+		}
+		// values identifying the old record have a "new" counterpart, except
+		// for CNAME which only has a single target
+		if _, ok := q[key]; ok && key != "cname" {
+			key = "new" + strings.ToUpper(key[:1]) + key[1:]
+		}
+		q[key] = values
+	}
+
+	return a.update(ctx, q)
+}
+
+// EnableRecord enables the disabled record r, keeping its other values.
+func (a *RecordsAPIService) EnableRecord(ctx context.Context, r *Record) (*Record, *http.Response, error) {
+	return a.setDisabled(ctx, r, false)
+}
+
+// DisableRecord disables the record r, keeping its other values. Disabled
+// records are kept in the zone but not served.
+func (a *RecordsAPIService) DisableRecord(ctx context.Context, r *Record) (*Record, *http.Response, error) {
+	return a.setDisabled(ctx, r, true)
+}
+
+// setDisabled updates the disabled state of r. The update API resets the
+// values it is not given, so the TTL and options of r are sent along.
+func (a *RecordsAPIService) setDisabled(ctx context.Context, r *Record, disabled bool) (*Record, *http.Response, error) {
+	q := recordQuery(r)
+	q.Set("ttl", strconv.Itoa(r.TTL))
+	q.Set("disable", strconv.FormatBool(disabled))
+	if r.Comments != "" {
+		q.Set("comments", r.Comments)
+	}
+	if r.ExpiryTTL > 0 {
+		q.Set("expiryTtl", strconv.Itoa(r.ExpiryTTL))
+	}
+	if len(r.RData.Glue) > 0 {
+		q.Set("glue", strings.Join(r.RData.Glue, ","))
+	}
+
+	return a.update(ctx, q)
+}
+
+func (a *RecordsAPIService) update(ctx context.Context, q url.Values) (*Record, *http.Response, error) {
+	reqURL := a.client.cfg.BaseURL + `/api/zones/records/update`
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("new UpdateRecord request: %w", err)
+	}
+
+	req.URL.RawQuery = q.Encode()
+
+	res, err := a.client.callAPI(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("do UpdateRecord request: %w", err)
+	}
+	defer res.Body.Close()
+
+	var body APIResponse[UpdateRecordResponse]
+	err = json.NewDecoder(res.Body).Decode(&body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decode UpdateRecord response: %w", err)
+	}
+
+	if body.Status != "ok" {
+		return nil, nil, fmt.Errorf("response UpdateRecord status not 'ok': %v, %v", body.Status, body.ErrorMessage)
+	}
+
+	return &body.Data.UpdatedRecord, res, nil
+}
+
+// recordQuery returns the query parameters identifying the record r.
+func recordQuery(r *Record) url.Values {
+	q := url.Values{}
+	q.Set("domain", r.Name)
+	q.Set("type", r.Type)
+	if r.Zone != "" {
+		q.Set("zone", r.Zone)
+	}
+
+	switch r.Type {
+	case "A":
+		q.Set("ipAddress", *r.RData.IPAddress)
+	case "AAAA":
+		q.Set("ipAddress", *r.RData.IPAddress)
+	case "CNAME":
+		q.Set("cname", *r.RData.CNAME)
+	case "NS":
+		q.Set("nameServer", *r.RData.NameServer)
+	case "PTR":
+		q.Set("ptrName", *r.RData.PTRName)
+	case "TXT":
+		q.Set("text", *r.RData.Text)
+	case "MX":
+		q.Set("preference", strconv.Itoa(*r.RData.Preference))
+		q.Set("exchange", *r.RData.Exchange)
+	case "SRV":
+		q.Set("priority", strconv.Itoa(*r.RData.Priority))
+		q.Set("weight", strconv.Itoa(*r.RData.Weight))
+		q.Set("port", strconv.Itoa(*r.RData.Port))
+		q.Set("target", *r.RData.Target)
+	case "CAA":
+		q.Set("flags", strconv.Itoa(*r.RData.Flags))
+		q.Set("tag", *r.RData.Tag)
+		q.Set("value", *r.RData.Value)
+	}
+
+	return q
+}
+
 type Record struct {
+	// Zone is the name of the zone the record was listed from, it is not
+	// part of the API response.
+	Zone         string  `json:"-"`
 	Disabled     bool    `json:"disabled"`
 	Name         string  `json:"name"`
 	Type         string  `json:"type"`
 	TTL          int     `json:"ttl"`
 	RData        RData   `json:"rData"`
+	Comments     string  `json:"comments,omitempty"`
+	ExpiryTTL    int     `json:"expiryTtl,omitempty"`
 	DNSSecStatus string  `json:"dnssecStatus"`
 	LastUsedOn   *string `json:"lastUsedOn,omitempty"`
 }
 
 type RData struct {
-	IPAddress  *string `json:"ipAddress,omitempty"`
-	CNAME      *string `json:"cname,omitempty"`
-	NameServer *string `json:"nameServer,omitempty"`
-	Text       *string `json:"text,omitempty"`
+	IPAddress  *string  `json:"ipAddress,omitempty"`
+	CNAME      *string  `json:"cname,omitempty"`
+	NameServer *string  `json:"nameServer,omitempty"`
+	Glue       []string `json:"glue,omitempty"`
+	PTRName    *string  `json:"ptrName,omitempty"`
+	Text       *string  `json:"text,omitempty"`
+	SplitText  *bool    `json:"splitText,omitempty"`
+	Preference *int     `json:"preference,omitempty"`
+	Exchange   *string  `json:"exchange,omitempty"`
+	Priority   *int     `json:"priority,omitempty"`
+	Weight     *int     `json:"weight,omitempty"`
+	Port       *int     `json:"port,omitempty"`
+	Target     *string  `json:"target,omitempty"`
+	Flags      *int     `json:"flags,omitempty"`
+	Tag        *string  `json:"tag,omitempty"`
+	Value      *string  `json:"value,omitempty"`
+}
+
+// UnmarshalJSON decodes the record data, keeping flags only when they are
+// numeric as DNSKEY and NSEC3PARAM records report theirs as text. Glue
+// addresses are accepted both as a list and as a comma separated string.
+func (d *RData) UnmarshalJSON(b []byte) error {
+	type rdata RData
+	aux := struct {
+		*rdata
+		Flags json.RawMessage `json:"flags,omitempty"`
+		Glue  json.RawMessage `json:"glue,omitempty"`
+	}{rdata: (*rdata)(d)}
+
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+
+	d.Flags = nil
+	var flags int
+	if len(aux.Flags) > 0 && json.Unmarshal(aux.Flags, &flags) == nil {
+		d.Flags = &flags
+	}
+
+	d.Glue = nil
+	var glue string
+	if len(aux.Glue) > 0 && json.Unmarshal(aux.Glue, &d.Glue) != nil {
+		if err := json.Unmarshal(aux.Glue, &glue); err != nil {
+			return fmt.Errorf("decode glue: %w", err)
+		}
+		for _, g := range strings.Split(glue, ",") {
+			if g = strings.TrimSpace(g); g != "" {
+				d.Glue = append(d.Glue, g)
+			}
+		}
+	}
+
+	return nil
 }
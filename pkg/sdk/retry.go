@@ -0,0 +1,153 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"syscall"
+	"time"
+)
+
+const (
+	// DefaultInitialBackoff is the wait before the first retry when the
+	// policy does not set one.
+	DefaultInitialBackoff = 200 * time.Millisecond
+	// DefaultMaxBackoff caps the wait between retries when the policy does
+	// not set a cap.
+	DefaultMaxBackoff = 5 * time.Second
+)
+
+// RetryPolicy configures how calls failing with a transport error, a 5xx or
+// 429 response or one of Statuses are retried. The wait between attempts
+// doubles from InitialBackoff up to MaxBackoff, with full jitter.
+//
+// Only calls safe to retry are retried: the read-only calls, and the calls
+// made with a context marked by WithRetry.
+type RetryPolicy struct {
+	// MaxAttempts bounds the attempts of a call, calls are not retried
+	// below 2.
+	MaxAttempts int
+	// MaxElapsed bounds the time spent on a call, no retry is started past
+	// it. Zero leaves it to MaxAttempts and the context.
+	MaxElapsed     time.Duration
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Statuses lists the Technitium response statuses that are retried
+	Statuses []string
+}
+
+type retryKey struct{}
+
+// WithRetry marks the calls made with ctx as safe to retry. Writes are only
+// retried when marked, as a retried write may apply twice.
+func WithRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryKey{}, true)
+}
+
+func retrySafe(ctx context.Context) bool {
+	safe, _ := ctx.Value(retryKey{}).(bool)
+	return safe
+}
+
+// retryReason tells why the outcome of an attempt should be retried, or
+// returns an empty string when it should not.
+func (p RetryPolicy) retryReason(resp *http.Response, err error) string {
+	if err != nil {
+		if transient(err) {
+			return err.Error()
+		}
+		return ""
+	}
+	if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests {
+		return resp.Status
+	}
+	if len(p.Statuses) == 0 {
+		return ""
+	}
+	status, err := peekStatus(resp)
+	if err != nil {
+		return err.Error()
+	}
+	if slices.Contains(p.Statuses, status) {
+		return fmt.Sprintf("status %s", status)
+	}
+	return ""
+}
+
+// transient reports whether the transport error err may go away on retry:
+// a timeout, a refused or reset connection or a response cut short.
+// Other errors, e.g. TLS or URL errors, fail the same way every time.
+func transient(err error) bool {
+	// every error of the HTTP client is an *url.Error, which is a net.Error
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// backoff returns the wait before the retry following attempt, picked at
+// random up to the exponential backoff.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	initial, limit := p.InitialBackoff, p.MaxBackoff
+	if initial <= 0 {
+		initial = DefaultInitialBackoff
+	}
+	if limit <= 0 {
+		limit = DefaultMaxBackoff
+	}
+
+	wait := initial
+	for i := 1; i < attempt && wait < limit; i++ {
+		wait *= 2
+	}
+	wait = min(wait, limit)
+	return rand.N(wait) + 1
+}
+
+// callAPI sends req, retrying it following the retry policy when it is safe
+// to retry. The response of the last attempt is returned.
+func (c *APIClient) callAPI(req *http.Request) (*http.Response, error) {
+	policy := c.cfg.Retry
+	ctx := req.Context()
+	if policy.MaxAttempts < 2 || !retrySafe(ctx) {
+		return c.callOnce(req)
+	}
+
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		resp, err := c.callOnce(req)
+		reason := policy.retryReason(resp, err)
+		if reason == "" || attempt >= policy.MaxAttempts || ctx.Err() != nil {
+			return resp, err
+		}
+		wait := policy.backoff(attempt)
+		if policy.MaxElapsed > 0 && time.Since(start)+wait > policy.MaxElapsed {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		slog.Debug("retrying Technitium call", "path", req.URL.Path, "attempt", attempt, "wait", wait, "reason", reason)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("retry %s: %w", req.URL.Path, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
@@ -1,7 +1,11 @@
 package sdk
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httputil"
@@ -16,11 +20,21 @@ type Configuration struct {
 	Debug      bool
 	User       string
 	Pass       string
+	// Token is a non-expiring API token. When set, User and Pass are
+	// ignored and the client never logs in.
+	Token string
+	// ZonesPerPage is the page size of zone listings, DefaultZonesPerPage
+	// when not set.
+	ZonesPerPage int
+	// Retry is the retry policy of failed calls, calls are not retried by
+	// default.
+	Retry RetryPolicy
 }
 
 type APIClient struct {
 	cfg    *Configuration
 	common service
+	tokens *tokenManager
 
 	// API Services
 	ZonesAPI   *ZonesAPIService
@@ -36,6 +50,8 @@ type APIResponse[T any] struct {
 	InnerErrorMessage string `json:"innerErrorMessage,omitempty"`
 }
 
+const statusInvalidToken = "invalid-token"
+
 type service struct {
 	client *APIClient
 }
@@ -48,6 +64,7 @@ func NewAPIClient(cfg *Configuration) *APIClient {
 	c := &APIClient{}
 	c.cfg = cfg
 	c.common.client = c
+	c.tokens = &tokenManager{client: c}
 
 	c.ZonesAPI = (*ZonesAPIService)(&c.common)
 	c.RecordsAPI = (*RecordsAPIService)(&c.common)
@@ -56,14 +73,51 @@ func NewAPIClient(cfg *Configuration) *APIClient {
 	return c
 }
 
-func (c *APIClient) callAPI(req *http.Request) (*http.Response, error) {
-	token, _, err := c.UsersAPI.Login(c.cfg.User, c.cfg.Pass)
+// Logout ends the cached Technitium session. It should be called once the
+// client is no longer used.
+func (c *APIClient) Logout(ctx context.Context) error {
+	return c.tokens.logout(ctx)
+}
+
+// callOnce sends req, logging in again and resending it once when the cached
+// session expired.
+func (c *APIClient) callOnce(req *http.Request) (*http.Response, error) {
+	token, err := c.tokens.get(req.Context())
 	if err != nil {
 		return nil, err
 	}
 
+	resp, err := c.do(req, token)
+	if err != nil {
+		return resp, err
+	}
+
+	status, err := peekStatus(resp)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	// an API token cannot be refreshed, let the caller report the status
+	if status != statusInvalidToken || c.cfg.Token != "" {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	// the cached session expired or was revoked, log in again and retry once
+	c.tokens.invalidate(token)
+	token, err = c.tokens.get(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	return c.do(req, token)
+}
+
+// do sends a copy of req authenticated with token.
+func (c *APIClient) do(req *http.Request, token string) (*http.Response, error) {
+	req = req.Clone(req.Context())
 	q := req.URL.Query()
-	q.Add("token", token)
+	q.Set("token", token)
 	req.URL.RawQuery = q.Encode()
 
 	if c.cfg.Debug {
@@ -90,6 +144,25 @@ func (c *APIClient) callAPI(req *http.Request) (*http.Response, error) {
 	return resp, err
 }
 
+// peekStatus decodes the Technitium status of resp and rewinds its body so
+// callers can still decode the full response.
+func peekStatus(resp *http.Response) (string, error) {
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read response: %w", err)
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(b))
+
+	var body struct {
+		Status string `json:"status"`
+	}
+	// bodies that are not JSON are left for the caller to report
+	_ = json.Unmarshal(b, &body)
+
+	return body.Status, nil
+}
+
 func structToQuery(s interface{}) url.Values {
     values := url.Values{}
     val := reflect.ValueOf(s)
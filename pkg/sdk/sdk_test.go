@@ -1,10 +1,15 @@
 package sdk
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestListRecords(t *testing.T) {
@@ -526,7 +531,7 @@ func TestListRecords(t *testing.T) {
 }`)
 	})
 
-	records, _, err := client.RecordsAPI.ListRecords("example.com")
+	records, _, err := client.RecordsAPI.ListRecords(context.Background(), "example.com")
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -536,6 +541,36 @@ func TestListRecords(t *testing.T) {
 	}
 }
 
+func TestListDomainRecords(t *testing.T) {
+	mux, client := setup(t)
+	mux.HandleFunc("GET /api/zones/records/get", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if listZone := q.Get("listZone"); listZone != "false" {
+			t.Errorf("unexpected listZone: wanted: %v, got: %v", "false", listZone)
+		}
+		if zone := q.Get("zone"); zone != "example.com" {
+			t.Errorf("unexpected zone: wanted: %v, got: %v", "example.com", zone)
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{
+			"response": {
+				"zone": {"name": "example.com"},
+				"records": [{"name": "www.example.com", "type": "A", "ttl": 60, "rData": {"ipAddress": "1.1.1.1"}}]
+			},
+			"status": "ok"
+}`)
+	})
+
+	records, _, err := client.RecordsAPI.ListDomainRecords(context.Background(), "example.com", "www.example.com")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(records) != 1 || records[0].Zone != "example.com" || records[0].TTL != 60 {
+		t.Errorf("unexpected records: %+v", records)
+	}
+}
+
 func TestCreateARecord(t *testing.T) {
 	mux, client := setup(t)
 	mux.HandleFunc("GET /api/zones/records/add", func(w http.ResponseWriter, r *http.Request) {
@@ -570,7 +605,7 @@ func TestCreateARecord(t *testing.T) {
 	})
 
 	ipAddress := "3.3.3.3"
-	record, _, err := client.RecordsAPI.CreateRecord(&RecordRequest{
+	record, _, err := client.RecordsAPI.CreateRecord(context.Background(), &RecordRequest{
 		Token:     "test-token",
 		Domain:    "example.com",
 		Type:      "A",
@@ -615,7 +650,7 @@ func TestCreateCNAMERecord(t *testing.T) {
 	})
 
 	cname := "example.internal.com"
-	record, _, err := client.RecordsAPI.CreateRecord(&RecordRequest{
+	record, _, err := client.RecordsAPI.CreateRecord(context.Background(), &RecordRequest{
 		Token:  "test-token",
 		Domain: "example.com",
 		Type:   "CNAME",
@@ -629,10 +664,329 @@ func TestCreateCNAMERecord(t *testing.T) {
 		t.Errorf("unexpected record response: %+v", record)
 	}
 }
+func TestCAARecordData(t *testing.T) {
+	mux, client := setup(t)
+	mux.HandleFunc("GET /api/zones/records/get", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{
+			"response": {
+				"records": [
+					{
+						"name": "example.com",
+						"type": "CAA",
+						"ttl": 3600,
+						"rData": {
+							"flags": 0,
+							"tag": "issue",
+							"value": "letsencrypt.org"
+						}
+					},
+					{
+						"name": "example.com",
+						"type": "DNSKEY",
+						"ttl": 3600,
+						"rData": {
+							"flags": "ZoneKey"
+						}
+					}
+				]
+			},
+			"status": "ok"
+}`)
+	})
+
+	records, _, err := client.RecordsAPI.ListRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	caa := records[0].RData
+	if caa.Flags == nil || *caa.Flags != 0 || *caa.Tag != "issue" || *caa.Value != "letsencrypt.org" {
+		t.Errorf("unexpected CAA record data: %+v", caa)
+	}
+	if records[1].RData.Flags != nil {
+		t.Errorf("unexpected DNSKEY flags: %v", *records[1].RData.Flags)
+	}
+}
+
+func TestNSRecordData(t *testing.T) {
+	mux, client := setup(t)
+	mux.HandleFunc("GET /api/zones/records/get", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{
+			"response": {
+				"zone": {
+					"name": "example.com"
+				},
+				"records": [
+					{
+						"name": "sub.example.com",
+						"type": "NS",
+						"ttl": 3600,
+						"rData": {
+							"nameServer": "ns1.sub.example.com",
+							"glue": ["192.0.2.1", "2001:db8::1"]
+						}
+					},
+					{
+						"name": "sub.example.com",
+						"type": "NS",
+						"ttl": 3600,
+						"rData": {
+							"nameServer": "ns2.sub.example.com",
+							"glue": "192.0.2.2, 192.0.2.3"
+						}
+					}
+				]
+			},
+			"status": "ok"
+}`)
+	})
+
+	records, _, err := client.RecordsAPI.ListRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if records[0].Zone != "example.com" || len(records[0].RData.Glue) != 2 || records[0].RData.Glue[1] != "2001:db8::1" {
+		t.Errorf("unexpected NS record: %+v", records[0])
+	}
+	if len(records[1].RData.Glue) != 2 || records[1].RData.Glue[1] != "192.0.2.3" {
+		t.Errorf("unexpected NS record: %+v", records[1])
+	}
+}
+
+func TestDeleteMXRecord(t *testing.T) {
+	mux, client := setup(t)
+	mux.HandleFunc("GET /api/zones/records/delete", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if preference := q.Get("preference"); preference != "10" {
+			t.Errorf("unexpected preference: wanted: %v, got: %v", "10", preference)
+		}
+		if exchange := q.Get("exchange"); exchange != "mail.example.com" {
+			t.Errorf("unexpected exchange: wanted: %v, got: %v", "mail.example.com", exchange)
+		}
+		if zone := q.Get("zone"); zone != "example.com" {
+			t.Errorf("unexpected zone: wanted: %v, got: %v", "example.com", zone)
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"status": "ok"}`)
+	})
+
+	preference := 10
+	exchange := "mail.example.com"
+	_, err := client.RecordsAPI.DeleteRecord(context.Background(), &Record{
+		Zone:  "example.com",
+		Name:  "example.com",
+		Type:  "MX",
+		RData: RData{Preference: &preference, Exchange: &exchange},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestUpdateRecord(t *testing.T) {
+	mux, client := setup(t)
+	mux.HandleFunc("GET /api/zones/records/update", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		want := map[string]string{
+			"domain":       "example.com",
+			"zone":         "example.com",
+			"type":         "A",
+			"ipAddress":    "1.1.1.1",
+			"newIpAddress": "2.2.2.2",
+			"ttl":          "60",
+			"newDomain":    "",
+		}
+		for k, v := range want {
+			if got := q.Get(k); got != v {
+				t.Errorf("unexpected %s: wanted: %v, got: %v", k, v, got)
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{
+			"response": {
+				"zone": {
+					"name": "example.com",
+					"type": "Primary"
+				},
+				"updatedRecord": {
+					"name": "example.com",
+					"type": "A",
+					"ttl": 60,
+					"rData": {
+						"ipAddress": "2.2.2.2"
+					}
+				}
+			},
+			"status": "ok"
+}`)
+	})
+
+	oldAddress, newAddress, ttl := "1.1.1.1", "2.2.2.2", 60
+	zone := "example.com"
+	record, _, err := client.RecordsAPI.UpdateRecord(context.Background(), &Record{
+		Zone:  "example.com",
+		Name:  "example.com",
+		Type:  "A",
+		RData: RData{IPAddress: &oldAddress},
+	}, &RecordRequest{
+		Domain:    "example.com",
+		Zone:      &zone,
+		Type:      "A",
+		TTL:       &ttl,
+		IPAddress: &newAddress,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if *record.RData.IPAddress != "2.2.2.2" || record.TTL != 60 {
+		t.Errorf("unexpected record response: %+v", record)
+	}
+}
+
+func TestEnableDisableRecord(t *testing.T) {
+	mux, client := setup(t)
+	var want string
+	mux.HandleFunc("GET /api/zones/records/update", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		params := map[string]string{
+			"domain":    "example.com",
+			"zone":      "example.com",
+			"type":      "A",
+			"ipAddress": "1.1.1.1",
+			"ttl":       "300",
+			"comments":  "managed",
+			"disable":   want,
+		}
+		for k, v := range params {
+			if got := q.Get(k); got != v {
+				t.Errorf("unexpected %s: wanted: %v, got: %v", k, v, got)
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{
+			"response": {
+				"zone": {
+					"name": "example.com",
+					"type": "Primary"
+				},
+				"updatedRecord": {
+					"disabled": %s,
+					"name": "example.com",
+					"type": "A",
+					"ttl": 300,
+					"rData": {
+						"ipAddress": "1.1.1.1"
+					}
+				}
+			},
+			"status": "ok"
+}`, want)
+	})
+
+	address := "1.1.1.1"
+	r := &Record{
+		Zone:     "example.com",
+		Name:     "example.com",
+		Type:     "A",
+		TTL:      300,
+		Comments: "managed",
+		RData:    RData{IPAddress: &address},
+	}
+
+	want = "true"
+	record, _, err := client.RecordsAPI.DisableRecord(context.Background(), r)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !record.Disabled {
+		t.Errorf("expected disabled record, got %+v", record)
+	}
+
+	want = "false"
+	record, _, err = client.RecordsAPI.EnableRecord(context.Background(), r)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if record.Disabled {
+		t.Errorf("expected enabled record, got %+v", record)
+	}
+}
+
+func TestUpdateCNAMERecord(t *testing.T) {
+	mux, client := setup(t)
+	mux.HandleFunc("GET /api/zones/records/update", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if cname := q.Get("cname"); cname != "new.example.com" {
+			t.Errorf("unexpected cname: wanted: %v, got: %v", "new.example.com", cname)
+		}
+		if newCNAME := q.Get("newCname"); newCNAME != "" {
+			t.Errorf("unexpected newCname: %v", newCNAME)
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"status": "error", "errorMessage": "no such record"}`)
+	})
+
+	oldCNAME, newCNAME := "old.example.com", "new.example.com"
+	_, _, err := client.RecordsAPI.UpdateRecord(context.Background(), &Record{
+		Name:  "www.example.com",
+		Type:  "CNAME",
+		RData: RData{CNAME: &oldCNAME},
+	}, &RecordRequest{
+		Domain: "www.example.com",
+		Type:   "CNAME",
+		CNAME:  &newCNAME,
+	})
+	if err == nil || !strings.Contains(err.Error(), "no such record") {
+		t.Errorf("expected status error, got %v", err)
+	}
+}
+
 func TestListZones(t *testing.T) {
 	mux, client := setup(t)
 	mux.HandleFunc("GET /api/zones/list", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if got := q.Get("zonesPerPage"); got != "10" {
+			t.Errorf("unexpected zonesPerPage: wanted: 10, got: %v", got)
+		}
 		w.WriteHeader(http.StatusOK)
+		if q.Get("pageNumber") == "2" {
+			fmt.Fprint(w, `{
+			"response": {
+				"pageNumber": 2,
+				"totalPages": 2,
+				"totalZones": 12,
+				"zones": [
+					{
+						"name": "test3.com",
+						"type": "Primary",
+						"internal": false,
+						"dnssecStatus": "Unsigned",
+						"soaSerial": 1,
+						"lastModified": "2022-02-26T07:57:08.1842183Z",
+						"disabled": false
+					},
+					{
+						"name": "test4.com",
+						"type": "Forwarder",
+						"internal": false,
+						"dnssecStatus": "Unsigned",
+						"soaSerial": 1,
+						"lastModified": "2022-02-26T07:57:08.1842183Z",
+						"disabled": false
+					}
+				]
+			},
+			"status": "ok"
+}`)
+			return
+		}
+		if got := q.Get("pageNumber"); got != "1" {
+			t.Errorf("unexpected pageNumber: wanted: 1, got: %v", got)
+		}
 		fmt.Fprint(w, `{
 			"response": {
 				"pageNumber": 1,
@@ -745,20 +1099,57 @@ func TestListZones(t *testing.T) {
 }`)
 	})
 
-	zones, _, err := client.ZonesAPI.ListZones()
+	client.cfg.ZonesPerPage = 10
+	zones, _, err := client.ZonesAPI.ListZones(context.Background())
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 
-	if zones[0].Name != "" {
-		t.Errorf("unexpected record response: %+v", zones[0])
+	if len(zones) != 12 {
+		t.Fatalf("expected the zones of both pages, got %d", len(zones))
+	}
+	if zones[0].Name != "" || zones[11].Name != "test4.com" {
+		t.Errorf("unexpected record response: %+v", zones)
+	}
+
+	var names []string
+	for zone, err := range client.ZonesAPI.Zones(context.Background()) {
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		names = append(names, zone.Name)
+		if zone.Name == "test3.com" {
+			break
+		}
+	}
+	if len(names) != 11 {
+		t.Errorf("expected iteration to stop at test3.com, got %v", names)
+	}
+}
+
+func TestZonesError(t *testing.T) {
+	mux, client := setup(t)
+	mux.HandleFunc("GET /api/zones/list", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"status": "error", "errorMessage": "access denied"}`)
+	})
+
+	var errs int
+	for _, err := range client.ZonesAPI.Zones(context.Background()) {
+		if err == nil || !strings.Contains(err.Error(), "access denied") {
+			t.Errorf("unexpected error: %v", err)
+		}
+		errs++
+	}
+	if errs != 1 {
+		t.Errorf("expected a single error, got %d", errs)
 	}
 }
 
 func TestLogin(t *testing.T) {
 	_, client := setup(t)
 
-	token, _, err := client.UsersAPI.Login("admin", "admin")
+	token, _, err := client.UsersAPI.Login(context.Background(), "admin", "admin")
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -768,9 +1159,228 @@ func TestLogin(t *testing.T) {
 	}
 }
 
+func TestTokenReuse(t *testing.T) {
+	mux, client := setup(t)
+	mux.HandleFunc("GET /api/zones/list", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"response": {"zones": []}, "status": "ok"}`)
+	})
+
+	before := logins.Load()
+	for i := 0; i < 3; i++ {
+		if _, _, err := client.ZonesAPI.ListZones(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	if n := logins.Load() - before; n != 1 {
+		t.Errorf("expected 1 login, got %d", n)
+	}
+}
+
+func TestTokenRefresh(t *testing.T) {
+	mux, client := setup(t)
+	var calls atomic.Int32
+	mux.HandleFunc("GET /api/zones/list", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if calls.Add(1) == 2 {
+			fmt.Fprint(w, `{"status": "invalid-token", "errorMessage": "Invalid token or session expired."}`)
+			return
+		}
+		fmt.Fprint(w, `{"response": {"zones": []}, "status": "ok"}`)
+	})
+
+	before := logins.Load()
+	for i := 0; i < 2; i++ {
+		if _, _, err := client.ZonesAPI.ListZones(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	if n := logins.Load() - before; n != 2 {
+		t.Errorf("expected 2 logins, got %d", n)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("expected 3 calls, got %d", n)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	mux, client := setup(t)
+	mux.HandleFunc("GET /api/zones/list", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"response": {"zones": []}, "status": "ok"}`)
+	})
+	var loggedOut string
+	mux.HandleFunc("GET /api/user/logout", func(w http.ResponseWriter, r *http.Request) {
+		loggedOut = r.URL.Query().Get("token")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"status": "ok"}`)
+	})
+
+	if _, _, err := client.ZonesAPI.ListZones(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := client.Logout(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if loggedOut != "932b2a3495852c15af01598f62563ae534460388b6a370bfbbb8bb6094b698e9" {
+		t.Errorf("unexpected logout token: %v", loggedOut)
+	}
+}
+
+func TestAPIToken(t *testing.T) {
+	mux, client := setup(t)
+	client.cfg.Token = "api-token"
+	mux.HandleFunc("GET /api/zones/list", func(w http.ResponseWriter, r *http.Request) {
+		if token := r.URL.Query().Get("token"); token != "api-token" {
+			t.Errorf("wrong token, expected: %v, got: %v", "api-token", token)
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"response": {"zones": []}, "status": "ok"}`)
+	})
+
+	before := logins.Load()
+	if _, _, err := client.ZonesAPI.ListZones(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := client.Logout(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if n := logins.Load() - before; n != 0 {
+		t.Errorf("expected no login, got %d", n)
+	}
+}
+
+func TestContextCancellation(t *testing.T) {
+	mux, client := setup(t)
+	mux.HandleFunc("GET /api/zones/list", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("request should not be sent with a cancelled context")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := client.ZonesAPI.ListZones(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+var logins atomic.Int32
+
+func TestRetry(t *testing.T) {
+	mux, client := setup(t)
+	client.cfg.Retry = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Statuses: []string{"busy"}}
+
+	var zoneCalls atomic.Int32
+	mux.HandleFunc("GET /api/zones/list", func(w http.ResponseWriter, r *http.Request) {
+		switch zoneCalls.Add(1) {
+		case 1:
+			// drop the connection without a response
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Errorf("hijack: %v", err)
+				return
+			}
+			conn.Close()
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			fmt.Fprint(w, `{"response": {"zones": [{"name": "example.com"}]}, "status": "ok"}`)
+		}
+	})
+	var addCalls atomic.Int32
+	mux.HandleFunc("GET /api/zones/records/add", func(w http.ResponseWriter, r *http.Request) {
+		addCalls.Add(1)
+		fmt.Fprint(w, `{"status": "busy", "errorMessage": "try again"}`)
+	})
+
+	// read-only calls are retried
+	zones, _, err := client.ZonesAPI.ListZones(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(zones) != 1 || zoneCalls.Load() != 3 {
+		t.Errorf("expected 3 attempts, got %d: %+v", zoneCalls.Load(), zones)
+	}
+
+	// writes are only retried when marked safe
+	ipAddress := "3.3.3.3"
+	req := &RecordRequest{Domain: "example.com", Type: "A", IPAddress: &ipAddress}
+	if _, _, err := client.RecordsAPI.CreateRecord(context.Background(), req); err == nil {
+		t.Errorf("expected an error")
+	}
+	if got := addCalls.Load(); got != 1 {
+		t.Errorf("expected a single attempt, got %d", got)
+	}
+	addCalls.Store(0)
+	if _, _, err := client.RecordsAPI.CreateRecord(WithRetry(context.Background()), req); err == nil || !strings.Contains(err.Error(), "try again") {
+		t.Errorf("expected the last error, got %v", err)
+	}
+	if got := addCalls.Load(); got != 3 {
+		t.Errorf("expected 3 attempts, got %d", got)
+	}
+
+	// no retry is started past the time budget
+	client.cfg.Retry.MaxElapsed = time.Nanosecond
+	addCalls.Store(0)
+	client.RecordsAPI.CreateRecord(WithRetry(context.Background()), req)
+	if got := addCalls.Load(); got != 1 {
+		t.Errorf("expected a single attempt, got %d", got)
+	}
+}
+
+func TestRetryPermanentError(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	t.Cleanup(server.Close)
+
+	// the certificate of the server is unknown to the client, and the
+	// scheme of the other URL unsupported
+	for _, baseURL := range []string{server.URL, "ftp://" + server.Listener.Addr().String()} {
+		transport := &countingTransport{}
+		client := NewAPIClient(&Configuration{
+			BaseURL:    baseURL,
+			Token:      "test-token",
+			HTTPClient: &http.Client{Transport: transport},
+			Retry:      RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+		})
+		if _, _, err := client.ZonesAPI.ListZones(context.Background()); err == nil {
+			t.Errorf("%s: expected an error", baseURL)
+		}
+		if got := transport.calls.Load(); got != 1 {
+			t.Errorf("%s: expected a single attempt, got %d", baseURL, got)
+		}
+	}
+}
+
+// countingTransport counts the requests it sends.
+type countingTransport struct {
+	calls atomic.Int32
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.calls.Add(1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt, limit := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 10: time.Second} {
+		for range 100 {
+			if wait := policy.backoff(attempt); wait <= 0 || wait > limit {
+				t.Fatalf("backoff of attempt %d out of (0, %v]: %v", attempt, limit, wait)
+			}
+		}
+	}
+}
+
 func setup(t *testing.T) (*http.ServeMux, *APIClient) {
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /api/user/login", func(w http.ResponseWriter, r *http.Request) {
+		logins.Add(1)
 		q := r.URL.Query()
 		if user := q.Get("user"); user != "admin" {
 			t.Errorf("wrong user, expected: %v, got: %v", "admin", user)
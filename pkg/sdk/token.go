@@ -0,0 +1,65 @@
+package sdk
+
+import (
+	"context"
+	"sync"
+)
+
+// tokenManager caches the session token returned by the login API and hands
+// it out to concurrent callers until Technitium reports it as invalid.
+type tokenManager struct {
+	client *APIClient
+
+	mu    sync.Mutex
+	token string
+}
+
+// get returns the configured API token or the cached session token, logging
+// in first if there is none. The lock is held during login so concurrent
+// callers share a single login.
+func (m *tokenManager) get(ctx context.Context) (string, error) {
+	if m.client.cfg.Token != "" {
+		return m.client.cfg.Token, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.token != "" {
+		return m.token, nil
+	}
+
+	token, _, err := m.client.UsersAPI.Login(ctx, m.client.cfg.User, m.client.cfg.Pass)
+	if err != nil {
+		return "", err
+	}
+	m.token = token
+
+	return token, nil
+}
+
+// invalidate drops token if it is still the cached one, so callers racing on
+// the same expired token only trigger one new login.
+func (m *tokenManager) invalidate(token string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.token == token {
+		m.token = ""
+	}
+}
+
+// logout ends the cached session, if any. API tokens are left untouched.
+func (m *tokenManager) logout(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.token == "" {
+		return nil
+	}
+
+	_, err := m.client.UsersAPI.Logout(ctx, m.token)
+	m.token = ""
+
+	return err
+}
@@ -1,6 +1,7 @@
 package sdk
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -19,10 +20,10 @@ type LoginResponse struct {
 	InnerErrorMessage string  `json:"innerErrorMessage,omitempty"`
 }
 
-func (a *UsersAPIService) Login(user, pass string) (string, *http.Response, error) {
+func (a *UsersAPIService) Login(ctx context.Context, user, pass string) (string, *http.Response, error) {
 	reqURL := a.client.cfg.BaseURL + "/api/user/login"
 
-	req, err := http.NewRequest(http.MethodGet, reqURL, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
 	if err != nil {
 		return "", nil, fmt.Errorf("new Login request: %w", err)
 	}
@@ -51,3 +52,34 @@ func (a *UsersAPIService) Login(user, pass string) (string, *http.Response, erro
 
 	return *body.Token, nil, nil
 }
+
+func (a *UsersAPIService) Logout(ctx context.Context, token string) (*http.Response, error) {
+	reqURL := a.client.cfg.BaseURL + "/api/user/logout"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("new Logout request: %w", err)
+	}
+
+	q := url.Values{}
+	q.Set("token", token)
+	req.URL.RawQuery = q.Encode()
+
+	res, err := a.client.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("do Logout request: %w", err)
+	}
+	defer res.Body.Close()
+
+	var body APIResponse[interface{}]
+	err = json.NewDecoder(res.Body).Decode(&body)
+	if err != nil {
+		return nil, fmt.Errorf("decode Logout response: %w", err)
+	}
+
+	if body.Status != "ok" {
+		return nil, fmt.Errorf("response Logout status not 'ok': %v, %v", body.Status, body.ErrorMessage)
+	}
+
+	return res, nil
+}
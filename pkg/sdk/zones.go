@@ -1,9 +1,13 @@
 package sdk
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"iter"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 )
 
@@ -16,13 +20,69 @@ type ListZonesResponse struct {
 	Zones      []Zone `json:"zones"`
 }
 
-func (a *ZonesAPIService) ListZones() ([]Zone, *http.Response, error) {
-	url := a.client.cfg.BaseURL + "/api/zones/list"
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+// DefaultZonesPerPage is the page size of zone listings when the
+// configuration does not set one.
+const DefaultZonesPerPage = 100
+
+// ListZones lists every zone, going through all pages of the listing. The
+// returned response is the one of the last page.
+func (a *ZonesAPIService) ListZones(ctx context.Context) ([]Zone, *http.Response, error) {
+	var zones []Zone
+	var res *http.Response
+	for page := 1; ; page++ {
+		body, r, err := a.ListZonesPage(ctx, page)
+		if err != nil {
+			return nil, nil, err
+		}
+		res = r
+		zones = append(zones, body.Zones...)
+		if page >= body.TotalPages || len(body.Zones) == 0 {
+			return zones, res, nil
+		}
+	}
+}
+
+// Zones streams the zones page by page, only requesting the next page once
+// the zones of the current one were consumed. A failing page yields its
+// error and ends the sequence.
+func (a *ZonesAPIService) Zones(ctx context.Context) iter.Seq2[Zone, error] {
+	return func(yield func(Zone, error) bool) {
+		for page := 1; ; page++ {
+			body, _, err := a.ListZonesPage(ctx, page)
+			if err != nil {
+				yield(Zone{}, err)
+				return
+			}
+			for _, zone := range body.Zones {
+				if !yield(zone, nil) {
+					return
+				}
+			}
+			if page >= body.TotalPages || len(body.Zones) == 0 {
+				return
+			}
+		}
+	}
+}
+
+// ListZonesPage lists a single page of zones, pages are numbered from 1.
+func (a *ZonesAPIService) ListZonesPage(ctx context.Context, page int) (*ListZonesResponse, *http.Response, error) {
+	reqURL := a.client.cfg.BaseURL + "/api/zones/list"
+	// listing is read-only, so always safe to retry
+	req, err := http.NewRequestWithContext(WithRetry(ctx), http.MethodGet, reqURL, nil)
 	if err != nil {
 		return nil, nil, fmt.Errorf("new ListZones request: %w", err)
 	}
 
+	perPage := a.client.cfg.ZonesPerPage
+	if perPage <= 0 {
+		perPage = DefaultZonesPerPage
+	}
+	q := url.Values{}
+	q.Set("pageNumber", strconv.Itoa(page))
+	q.Set("zonesPerPage", strconv.Itoa(perPage))
+	req.URL.RawQuery = q.Encode()
+
 	res, err := a.client.callAPI(req)
 	if err != nil {
 		return nil, nil, fmt.Errorf("do ListZones request: %w", err)
@@ -39,7 +99,7 @@ func (a *ZonesAPIService) ListZones() ([]Zone, *http.Response, error) {
 		return nil, nil, fmt.Errorf("response status not 'ok': %v, %v", body.Status, body.ErrorMessage)
 	}
 
-	return body.Data.Zones, res, nil
+	return &body.Data, res, nil
 }
 
 type Zone struct {
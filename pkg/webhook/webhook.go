@@ -177,8 +177,12 @@ func (p *Webhook) ApplyChanges(w http.ResponseWriter, r *http.Request) {
 	requestLog(r).Debugf("requesting apply changes, create: %d , updateOld: %d, updateNew: %d, delete: %d",
 		len(changes.Create), len(changes.UpdateOld), len(changes.UpdateNew), len(changes.Delete))
 	if err := p.provider.ApplyChanges(ctx, &changes); err != nil {
+		requestLog(r).WithField(logFieldError, err).Error("error applying changes")
 		w.Header().Set(contentTypeHeader, contentTypePlaintext)
 		w.WriteHeader(http.StatusInternalServerError)
+		if _, writeError := fmt.Fprint(w, err.Error()); writeError != nil {
+			requestLog(r).WithField(logFieldError, writeError).Error("error writing error message to response writer")
+		}
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)